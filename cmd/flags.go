@@ -2,16 +2,37 @@ package cmd
 
 import (
 	"flag"
+	"strings"
 )
 
 type Flags struct {
 	ConfigFile string
+	Command    string   // optional subcommand following the flags
+	Args       []string // arguments of the subcommand
 }
 
 func ParseFlags() Flags {
 	config := flag.String("config-file", "~/.axis/config.toml", "path to configuration file")
 	flag.Parse()
+	args := []string{}
+	if flag.NArg() > 1 {
+		args = flag.Args()[1:]
+	}
 	return Flags{
 		ConfigFile: *config,
+		Command:    flag.Arg(0),
+		Args:       args,
 	}
 }
+
+// StringsFlag is a flag that may be set multiple times
+type StringsFlag []string
+
+func (f *StringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *StringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/crossedbot/common/golang/config"
@@ -15,6 +19,8 @@ import (
 
 	"github.com/crossedbot/axis/cmd"
 	"github.com/crossedbot/axis/pkg/pins/controller"
+	pinsdb "github.com/crossedbot/axis/pkg/pins/database"
+	"github.com/crossedbot/axis/pkg/pins/models"
 )
 
 const (
@@ -42,7 +48,7 @@ func newServer(c Config) server.Server {
 	)
 	for _, route := range controller.Routes {
 		srv.Add(
-			route.Handler,
+			route.AuthorizedHandler(),
 			route.Method,
 			route.Path,
 			route.ResponseSettings...,
@@ -52,8 +58,6 @@ func newServer(c Config) server.Server {
 }
 
 func run(ctx context.Context) error {
-	f := cmd.ParseFlags()
-	config.Path(f.ConfigFile)
 	var c Config
 	if err := config.Load(&c); err != nil {
 		return err
@@ -70,10 +74,177 @@ func run(ctx context.Context) error {
 	return nil
 }
 
+// migrate migrates the configured pins database to its latest schema version.
+func migrate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	owner := fs.String("owner", "", "assign pins without an owner to this user ID (redis)")
+	fs.Parse(args)
+	var c controller.Config
+	if err := config.Load(&c); err != nil {
+		return err
+	}
+	switch strings.ToLower(c.DatabaseDriver) {
+	case "", pinsdb.DriverRedis:
+		from, to, err := pinsdb.Migrate(ctx, c.DatabaseAddr, *owner)
+		if err != nil {
+			return err
+		}
+		if from == to {
+			logger.Info(fmt.Sprintf(
+				"Database schema is up to date (version %d)",
+				to,
+			))
+		} else {
+			logger.Info(fmt.Sprintf(
+				"Migrated database schema from version %d to %d",
+				from, to,
+			))
+		}
+	case pinsdb.DriverPostgres:
+		// migrations are applied when the database is opened
+		_, err := pinsdb.Open(
+			ctx, c.DatabaseDriver, c.DatabaseAddr, false,
+		)
+		if err != nil {
+			return err
+		}
+		logger.Info("Database schema is up to date")
+	default:
+		logger.Info(fmt.Sprintf(
+			"No migrations for database driver ('%s')",
+			c.DatabaseDriver,
+		))
+	}
+	return nil
+}
+
+// openOffline returns a Controller for the configured pins database only, so
+// that exporting and importing pins neither starts the pin watcher and
+// reconciler, nor drops the database on start.
+func openOffline(ctx context.Context) (controller.Controller, error) {
+	var c controller.Config
+	if err := config.Load(&c); err != nil {
+		return nil, err
+	}
+	db, err := pinsdb.Open(ctx, c.DatabaseDriver, c.DatabaseAddr, false)
+	if err != nil {
+		return nil, err
+	}
+	return controller.NewOffline(ctx, db), nil
+}
+
+// exportPins writes the pins matching the given arguments' filters to the output
+// file, or standard output, as newline delimited JSON records.
+func exportPins(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "", "path to output file; default is standard output")
+	var cids, statuses cmd.StringsFlag
+	fs.Var(&cids, "cid", "filter by CID; may be repeated")
+	fs.Var(&statuses, "status", "filter by status; may be repeated")
+	name := fs.String("name", "", "filter by name")
+	matchStr := fs.String("match", "exact", "name matching strategy")
+	before := fs.String("before", "", "filter by creation before RFC 3339 timestamp")
+	after := fs.String("after", "", "filter by creation after RFC 3339 timestamp")
+	metaStr := fs.String("meta", "", "filter by meta data (JSON object)")
+	fs.Parse(args)
+	match, err := models.ToTextMatch(*matchStr)
+	if err != nil {
+		return err
+	}
+	ss := []models.Status{}
+	for _, s := range statuses {
+		status, err := models.ToStatus(s)
+		if err != nil {
+			return err
+		}
+		ss = append(ss, status)
+	}
+	meta := models.Info{}
+	if *metaStr != "" {
+		if err := json.Unmarshal([]byte(*metaStr), &meta); err != nil {
+			return err
+		}
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		fd, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		w = fd
+	}
+	ctrl, err := openOffline(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := ctrl.ExportPins(
+		w, cids, *name, *before, *after, match, ss, meta,
+	)
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Exported %d pin(s)", n))
+	return nil
+}
+
+// importPins creates the pins of the newline delimited JSON records read from the
+// file argument, or standard input.
+func importPins(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	repin := fs.Bool("repin", false, "pin the imported CIDs to the IPFS cluster")
+	overwrite := fs.Bool("overwrite", false, "replace pins with the same request IDs")
+	fs.Parse(args)
+	var r io.Reader = os.Stdin
+	if fs.NArg() > 0 {
+		fd, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		r = fd
+	}
+	// only repinning requires the IPFS cluster
+	var ctrl controller.Controller
+	if *repin {
+		ctrl = controller.Ctrl()
+	} else {
+		var err error
+		if ctrl, err = openOffline(ctx); err != nil {
+			return err
+		}
+	}
+	n, err := ctrl.ImportPins(r, *repin, *overwrite)
+	if err != nil {
+		return fmt.Errorf("imported %d pin(s); %s", n, err)
+	}
+	logger.Info(fmt.Sprintf("Imported %d pin(s)", n))
+	return nil
+}
+
 func main() {
 	ctx := context.Background()
-	svc := service.New(ctx)
-	if err := svc.Run(run, syscall.SIGINT, syscall.SIGTERM); err != nil {
-		fatal("Error: %s", err)
+	f := cmd.ParseFlags()
+	config.Path(f.ConfigFile)
+	switch f.Command {
+	case "":
+		svc := service.New(ctx)
+		if err := svc.Run(run, syscall.SIGINT, syscall.SIGTERM); err != nil {
+			fatal("Error: %s", err)
+		}
+	case "migrate":
+		if err := migrate(ctx, f.Args); err != nil {
+			fatal("Error: %s", err)
+		}
+	case "export":
+		if err := exportPins(ctx, f.Args); err != nil {
+			fatal("Error: %s", err)
+		}
+	case "import":
+		if err := importPins(ctx, f.Args); err != nil {
+			fatal("Error: %s", err)
+		}
+	default:
+		fatal("Error: unknown command ('%s')", f.Command)
 	}
 }
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ApiKeyPrefix is the prefix of every API key, distinguishing them from
+	// JWTs
+	ApiKeyPrefix = "axis_"
+
+	// apiKeySize is the number of random bytes of an API key
+	apiKeySize = 32
+)
+
+// ApiKeyFunc represents a function returning the user ID, grant and scopes of
+// the given API key.
+type ApiKeyFunc func(key string) (userId, grant string, scopes []string, err error)
+
+var apiKeyFunc ApiKeyFunc = func(key string) (string, string, []string, error) {
+	return "", "", nil, ErrInvalidApiKey
+}
+var SetApiKeyFunc = func(fn ApiKeyFunc) {
+	apiKeyFunc = fn
+}
+
+// apiKeyContextKey is the key of the request context value set for requests
+// authenticated by an API key
+type apiKeyContextKey struct{}
+
+// NewApiKey returns a new, random, API key.
+func NewApiKey() (string, error) {
+	b := make([]byte, apiKeySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return ApiKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashApiKey returns the hex encoded SHA-256 hash of the given API key; as
+// stored in place of the key.
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsApiKey returns true if the given bearer token is an API key.
+func IsApiKey(tkn string) bool {
+	return strings.HasPrefix(tkn, ApiKeyPrefix)
+}
+
+// IsApiKeyRequest returns true if the given request was authenticated by an
+// API key.
+func IsApiKeyRequest(r *http.Request) bool {
+	v, _ := r.Context().Value(apiKeyContextKey{}).(bool)
+	return v
+}
+
+// withApiKey returns the given context, marked as authenticated by an API key.
+func withApiKey(ctx context.Context) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, true)
+}
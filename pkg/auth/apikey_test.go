@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/crossedbot/common/golang/server"
+	middleware "github.com/crossedbot/simplemiddleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewApiKey(t *testing.T) {
+	key, err := NewApiKey()
+	require.Nil(t, err)
+	require.True(t, IsApiKey(key))
+	require.Len(t, key, len(ApiKeyPrefix)+43)
+	other, err := NewApiKey()
+	require.Nil(t, err)
+	require.NotEqual(t, key, other)
+	require.Len(t, HashApiKey(key), 64)
+	require.Equal(t, HashApiKey(key), HashApiKey(key))
+	require.NotEqual(t, HashApiKey(key), HashApiKey(other))
+	require.False(t, IsApiKey("eyJhbGciOiJSUzI1NiJ9.e30.c2ln"))
+}
+
+func TestAuthorizeApiKey(t *testing.T) {
+	key, err := NewApiKey()
+	require.Nil(t, err)
+	defaultApiKeyFunc := apiKeyFunc
+	SetApiKeyFunc(func(k string) (string, string, []string, error) {
+		if k != key {
+			return "", "", nil, ErrInvalidApiKey
+		}
+		return "myuserid", "user", []string{ScopePinsRead}, nil
+	})
+	defer SetApiKeyFunc(defaultApiKeyFunc)
+	var userId interface{}
+	var isApiKey bool
+	var scopes []string
+	h := func(w http.ResponseWriter, r *http.Request, p server.Parameters) {
+		userId = r.Context().Value(middleware.ClaimUserId)
+		isApiKey = IsApiKeyRequest(r)
+		scopes = RequestScopes(r)
+		w.WriteHeader(http.StatusOK)
+	}
+	handler := Authorize(h, ScopePinsRead)
+	r := httptest.NewRequest(http.MethodGet, "/pins", nil)
+	r.Header.Set("Authorization", "Bearer "+key)
+	rr := httptest.NewRecorder()
+	handler(rr, r, server.Parameters{})
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "myuserid", userId)
+	require.True(t, isApiKey)
+	require.Equal(t, []string{ScopePinsRead}, scopes)
+	// keys hold only the scopes of the token they were issued by
+	r = httptest.NewRequest(http.MethodDelete, "/pins/abc", nil)
+	r.Header.Set("Authorization", "Bearer "+key)
+	rr = httptest.NewRecorder()
+	Authorize(h, ScopePinsDelete)(rr, r, server.Parameters{})
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	r = httptest.NewRequest(http.MethodGet, "/pins", nil)
+	r.Header.Set("Authorization", "Bearer "+ApiKeyPrefix+"unknown")
+	rr = httptest.NewRecorder()
+	handler(rr, r, server.Parameters{})
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+}
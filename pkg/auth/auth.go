@@ -1,8 +1,10 @@
 package auth
 
 import (
-	"crypto/x509"
-	"encoding/pem"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -13,35 +15,42 @@ import (
 	"github.com/crossedbot/axis/pkg/pins/models"
 )
 
-var KeyFunc = func(authAddr string) middleware.KeyFunc {
-	return func(token *middleware.Token) ([]byte, error) {
-		cert, err := getJwksCert(authAddr, token)
+// JwksKeyFunc returns the KeyFunc retrieving public keys from the JWKS document
+// at the given address. The document is cached in process.
+var JwksKeyFunc = func(authAddr string) KeyFunc {
+	cache := newJwksCache(authAddr)
+	return func(kid, alg string) (crypto.PublicKey, error) {
+		k, err := cache.Key(kid)
 		if err != nil {
 			return nil, err
 		}
-		if cert == "" {
-			return nil, ErrMissingJWKS
-		}
-		key, err := certPemToRsaPublicKey([]byte(cert))
-		if err != nil {
-			return nil, err
-		}
-		return pem.EncodeToMemory(
-			&pem.Block{
-				Type:  "RSA PUBLIC KEY",
-				Bytes: x509.MarshalPKCS1PublicKey(key),
-			},
-		), nil
+		return k.Verifier(alg)
 	}
 }
 
-var ErrFunc = func() middleware.ErrFunc {
-	return func(w http.ResponseWriter, err error) {
-		server.JsonResponse(w, models.NewFailure(
-			models.ErrUnauthorizedCode,
-			err.Error(),
-		), http.StatusUnauthorized)
+var keyFunc KeyFunc = func(kid, alg string) (crypto.PublicKey, error) {
+	return nil, ErrMissingJWKS
+}
+var SetKeyFunc = func(fn KeyFunc) {
+	keyFunc = fn
+}
+
+// unauthorized writes an unauthorized failure response for the given error.
+func unauthorized(w http.ResponseWriter, err error) {
+	server.JsonResponse(w, models.NewFailure(
+		models.ErrUnauthorizedCode,
+		err.Error(),
+	), http.StatusUnauthorized)
+}
+
+// bearerToken returns the bearer token of the given request's authorization
+// header. An empty string is returned if there is none.
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get(middleware.AuthHeader)
+	if len(h) >= 7 && strings.EqualFold(h[:7], "BEARER ") {
+		return h[7:]
 	}
+	return ""
 }
 
 var authGrants grants.Grant
@@ -56,19 +65,69 @@ var SetAuthGrants = func(grantStrs []string) error {
 	return err
 }
 
-func Authorize(handler server.Handler) server.Handler {
-	h := func(w http.ResponseWriter, r *http.Request, p server.Parameters) {
+// Authorize wraps the given handler for authenticating requests via a bearer
+// token, either a JWT signed by a key of the JWKS document or an API key, and
+// authorizing them against the configured grants and the given required
+// scopes. The user ID and grant claims, and the token's scopes, are set in the
+// request's context.
+func Authorize(handler server.Handler, scopes ...string) server.Handler {
+	return func(w http.ResponseWriter, r *http.Request, p server.Parameters) {
+		tkn := bearerToken(r)
+		if tkn == "" {
+			unauthorized(w, fmt.Errorf(
+				"missing authorization header: '%s'",
+				middleware.AuthHeader,
+			))
+			return
+		}
+		ctx := r.Context()
+		var userId, grant string
+		var tknScopes []string
+		if IsApiKey(tkn) {
+			var err error
+			userId, grant, tknScopes, err = apiKeyFunc(tkn)
+			if err != nil {
+				unauthorized(w, fmt.Errorf("invalid API key: %s", err))
+				return
+			}
+			ctx = withApiKey(ctx)
+		} else {
+			claims, err := verifyToken(tkn, keyFunc, claimsPolicy)
+			if err != nil {
+				unauthorized(w, err)
+				return
+			}
+			userId, _ = claims.Get(middleware.ClaimUserId).(string)
+			grant, _ = claims.Get(middleware.ClaimGrant).(string)
+			tknScopes = claimScopes(claims)
+		}
+		if userId == "" {
+			unauthorized(w, errors.New(
+				"user identifier is missing or invalid"))
+			return
+		}
+		if grant == "" {
+			unauthorized(w, errors.New("grant is missing or invalid"))
+			return
+		}
+		ctx = context.WithValue(ctx, middleware.ClaimUserId, userId)
+		ctx = context.WithValue(ctx, middleware.ClaimGrant, grant)
+		ctx = withScopes(ctx, tknScopes)
+		r = r.WithContext(ctx)
 		if authGrants != grants.GrantUnknown {
 			err := grants.ContainsGrant(authGrants, r)
 			if err != nil {
 				server.JsonResponse(w, models.NewFailure(
-					server.ErrUnauthorizedCode,
+					models.ErrForbiddenCode,
 					ErrUserForbidden.Error(),
 				), http.StatusForbidden)
 				return
 			}
 		}
+		if missing := missingScopes(tknScopes, scopes); len(missing) > 0 {
+			insufficientScope(w, missing)
+			return
+		}
 		handler(w, r, p)
 	}
-	return middleware.Authorize(h)
 }
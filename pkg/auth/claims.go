@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"time"
+
+	jwt "github.com/crossedbot/simplejwt"
+)
+
+// ClaimsPolicy represents the checks of a token's registered claims.
+type ClaimsPolicy struct {
+	// Issuer is the required iss claim; unchecked if unset. Tokens of a
+	// policy with an issuer must also set an exp claim.
+	Issuer string
+
+	// Audience is the value the aud claim must contain; unchecked if unset.
+	// Required by policies with an issuer, whose tokens may be issued for
+	// other services.
+	Audience string
+
+	// ClockSkew is the leeway given to the exp, nbf and iat claims
+	ClockSkew time.Duration
+}
+
+var claimsPolicy ClaimsPolicy
+var SetClaimsPolicy = func(p ClaimsPolicy) {
+	claimsPolicy = p
+}
+
+// Check returns nil if the policy is complete; an issuer requires an audience.
+// Otherwise an error is returned.
+func (p ClaimsPolicy) Check() error {
+	if p.Issuer != "" && p.Audience == "" {
+		return ErrMissingAudience
+	}
+	return nil
+}
+
+// Valid returns nil if the given claims are valid at the given time. Otherwise
+// an error is returned.
+func (p ClaimsPolicy) Valid(claims jwt.CustomClaims, now time.Time) error {
+	if p.Issuer != "" {
+		if iss, _ := claims.Get("iss").(string); iss != p.Issuer {
+			return ErrInvalidIssuer
+		}
+		if _, ok := claims.Get("exp").(float64); !ok {
+			return ErrMissingExpiration
+		}
+	}
+	if p.Audience != "" && !audienceContains(claims.Get("aud"), p.Audience) {
+		return ErrInvalidAudience
+	}
+	skew := int64(p.ClockSkew / time.Second)
+	t := now.Unix()
+	if exp, ok := claims.Get("exp").(float64); ok && t > int64(exp)+skew {
+		return jwt.ErrInvalidExpirationTime
+	}
+	if nbf, ok := claims.Get("nbf").(float64); ok && t < int64(nbf)-skew {
+		return jwt.ErrInvalidNotBefore
+	}
+	if iat, ok := claims.Get("iat").(float64); ok && t < int64(iat)-skew {
+		return jwt.ErrInvalidIssuedAt
+	}
+	return nil
+}
+
+// audienceContains returns true if the given aud claim, a string or an array
+// of strings, contains the given audience.
+func audienceContains(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/crossedbot/simplejwt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimsPolicyValid(t *testing.T) {
+	now := time.Unix(1621000000, 0)
+	policy := ClaimsPolicy{
+		Issuer:    "https://issuer.example.com",
+		Audience:  "axis",
+		ClockSkew: time.Minute,
+	}
+	valid := func(claims jwt.CustomClaims) jwt.CustomClaims {
+		c := jwt.CustomClaims{
+			"iss": "https://issuer.example.com",
+			"aud": "axis",
+			"exp": float64(now.Unix() + 60),
+		}
+		for k, v := range claims {
+			c[k] = v
+		}
+		return c
+	}
+	tests := []struct {
+		Claims   jwt.CustomClaims
+		Expected error
+	}{
+		{valid(nil), nil},
+		{valid(jwt.CustomClaims{"aud": []interface{}{"other", "axis"}}), nil},
+		{valid(jwt.CustomClaims{"exp": float64(now.Unix() - 60)}), nil},
+		{valid(jwt.CustomClaims{"nbf": float64(now.Unix() + 60)}), nil},
+		{valid(jwt.CustomClaims{"iat": float64(now.Unix() + 60)}), nil},
+		{valid(jwt.CustomClaims{"iss": "https://other.example.com"}), ErrInvalidIssuer},
+		{valid(jwt.CustomClaims{"aud": "other"}), ErrInvalidAudience},
+		{valid(jwt.CustomClaims{"aud": []interface{}{"other"}}), ErrInvalidAudience},
+		{jwt.CustomClaims{"iss": "https://issuer.example.com", "aud": "axis"}, ErrMissingExpiration},
+		{valid(jwt.CustomClaims{"exp": float64(now.Unix() - 61)}), jwt.ErrInvalidExpirationTime},
+		{valid(jwt.CustomClaims{"nbf": float64(now.Unix() + 61)}), jwt.ErrInvalidNotBefore},
+		{valid(jwt.CustomClaims{"iat": float64(now.Unix() + 61)}), jwt.ErrInvalidIssuedAt},
+	}
+	for _, test := range tests {
+		actual := policy.Valid(test.Claims, now)
+		require.Equal(t, test.Expected, actual, "%v", test.Claims)
+	}
+	// without an issuer or audience, only the times are checked
+	require.Nil(t, ClaimsPolicy{}.Valid(jwt.CustomClaims{}, now))
+	require.Equal(t, jwt.ErrInvalidExpirationTime, ClaimsPolicy{}.Valid(
+		jwt.CustomClaims{"exp": float64(now.Unix() - 1)}, now))
+}
+
+func TestClaimsPolicyCheck(t *testing.T) {
+	require.Nil(t, ClaimsPolicy{}.Check())
+	require.Nil(t, ClaimsPolicy{Audience: "axis"}.Check())
+	require.Nil(t, ClaimsPolicy{
+		Issuer:   "https://issuer.example.com",
+		Audience: "axis",
+	}.Check())
+	require.Equal(t, ErrMissingAudience, ClaimsPolicy{
+		Issuer: "https://issuer.example.com",
+	}.Check())
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/crossedbot/simplejwt/algorithms"
+)
+
+const (
+	// EdDSA is the name of the Edwards-curve signature algorithm, per RFC 8037
+	EdDSA = "EdDSA"
+)
+
+// eddsaAlg represents the EdDSA signing algorithm over Ed25519 keys.
+type eddsaAlg struct{}
+
+// AlgorithmEdDSA is the EdDSA signing algorithm.
+var AlgorithmEdDSA algorithms.SigningAlgorithm = eddsaAlg{}
+
+// Sign returns the EdDSA signature for the given data and private key. The key
+// is assumed to be a PEM encoded PKCS #8 key.
+func (e eddsaAlg) Sign(data string, key []byte) ([]byte, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, algorithms.ErrInvalidKeyType
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, algorithms.ErrInvalidKeyType
+	}
+	return ed25519.Sign(privateKey, []byte(data)), nil
+}
+
+// Valid returns nil if the signature is valid for the given data and public
+// key. Otherwise an error is returned. The key is assumed to be a PEM encoded
+// PKIX key.
+func (e eddsaAlg) Valid(data string, signature, key []byte) error {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return algorithms.ErrInvalidKeyType
+	}
+	k, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	publicKey, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return algorithms.ErrInvalidKeyType
+	}
+	if len(signature) != ed25519.SignatureSize {
+		return algorithms.ErrSignatureLength
+	}
+	if !ed25519.Verify(publicKey, []byte(data), signature) {
+		return algorithms.ErrInvalidSignature
+	}
+	return nil
+}
+
+// Name returns the name of the EdDSA algorithm.
+func (e eddsaAlg) Name() string {
+	return EdDSA
+}
@@ -5,8 +5,19 @@ import (
 )
 
 var (
-	ErrMissingJWKS    = errors.New("Failed to find matching key for token")
-	ErrRequestGrant   = errors.New("Request does not match grant")
-	ErrUserIdDataType = errors.New("User ID claim is not a string")
-	ErrUserForbidden  = errors.New("Not authorized to perform this action")
+	ErrMissingJWKS       = errors.New("Failed to find matching key for token")
+	ErrRequestGrant      = errors.New("Request does not match grant")
+	ErrUserIdDataType    = errors.New("User ID claim is not a string")
+	ErrUserForbidden     = errors.New("Not authorized to perform this action")
+	ErrKeyUse            = errors.New("Key is not for signatures")
+	ErrKeyAlgorithm      = errors.New("Key does not match the token's algorithm")
+	ErrKeyType           = errors.New("Key type is unsupported")
+	ErrInvalidKey        = errors.New("Key parameters are invalid")
+	ErrInvalidToken      = errors.New("Token is malformed")
+	ErrInvalidIssuer     = errors.New("Token issuer is invalid")
+	ErrInvalidAudience   = errors.New("Token audience is invalid")
+	ErrMissingExpiration = errors.New("Token expiration time is missing")
+	ErrInvalidApiKey     = errors.New("API key is invalid")
+	ErrInsufficientScope = errors.New("Token scope is insufficient")
+	ErrMissingAudience   = errors.New("Audience is required with an issuer")
 )
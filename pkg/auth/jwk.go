@@ -1,43 +1,218 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/json"
-	"encoding/pem"
-	"fmt"
-	"net/http"
+	"encoding/base64"
+	"math/big"
 
-	"github.com/crossedbot/simplejwt/jwk"
-	middleware "github.com/crossedbot/simplemiddleware"
+	"github.com/crossedbot/simplejwt/algorithms"
 )
 
-func getJwksCert(uri string, token *middleware.Token) (string, error) {
-	var jwks jwk.Jwks
-	resp, err := http.Get(uri)
+// List of supported key types
+const (
+	KeyTypeRSA = "RSA"
+	KeyTypeEC  = "EC"
+	KeyTypeOKP = "OKP"
+)
+
+// jsonWebKey represents a public JSON Web Key, per RFC 7517, RFC 7518 and RFC
+// 8037.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA parameters
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP parameters
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+
+	// X5C is the certificate chain of the key; the first certificate holds
+	// the key
+	X5C []string `json:"x5c,omitempty"`
+}
+
+// jsonWebKeySet represents a JWKS document.
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// Verifier returns the public key for verifying tokens signed with the given
+// algorithm. Returns an error if the key is not for signatures, or does not
+// match the algorithm.
+func (k jsonWebKey) Verifier(alg string) (crypto.PublicKey, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, ErrKeyUse
+	}
+	if k.Alg != "" && k.Alg != alg {
+		return nil, ErrKeyAlgorithm
+	}
+	key, err := k.PublicKey()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
-	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
-		return "", err
+	if !keyMatchesAlgorithm(key, alg) {
+		return nil, ErrKeyAlgorithm
 	}
-	for _, k := range jwks.Keys {
-		if token.Header["kid"] == k.KID {
-			return fmt.Sprintf(
-				"-----BEGIN CERTIFICATE-----\n%s\n-----END CERTIFICATE-----",
-				k.X5C[0],
-			), nil
-		}
+	return key, nil
+}
+
+// PublicKey returns the public key of the JWK. The key is built from its
+// parameters, or, if unset, from the first certificate of its chain.
+func (k jsonWebKey) PublicKey() (crypto.PublicKey, error) {
+	var key crypto.PublicKey
+	var err error
+	switch {
+	case k.Kty == KeyTypeRSA && k.N != "":
+		key, err = rsaPublicKey(k.N, k.E)
+	case k.Kty == KeyTypeEC && k.X != "":
+		key, err = ecdsaPublicKey(k.Crv, k.X, k.Y)
+	case k.Kty == KeyTypeOKP && k.X != "":
+		key, err = ed25519PublicKey(k.Crv, k.X)
+	case len(k.X5C) > 0:
+		key, err = certPublicKey(k.X5C[0])
+	default:
+		return nil, ErrKeyType
 	}
-	return "", nil
+	if err != nil {
+		return nil, err
+	}
+	if keyType(key) != k.Kty {
+		return nil, ErrKeyType
+	}
+	return key, nil
+}
+
+// rsaPublicKey returns the RSA public key of the given base64url encoded
+// modulus and exponent.
+func rsaPublicKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(eb)
+	if len(nb) == 0 || !exp.IsInt64() || exp.Int64() < 3 ||
+		exp.Int64() > 1<<31-1 {
+		return nil, ErrInvalidKey
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nb),
+		E: int(exp.Int64()),
+	}, nil
 }
 
-func certPemToRsaPublicKey(certPem []byte) (*rsa.PublicKey, error) {
-	block, _ := pem.Decode(certPem)
-	cert, err := x509.ParseCertificate(block.Bytes)
+// ecdsaPublicKey returns the ECDSA public key of the given curve and
+// base64url encoded coordinates.
+func ecdsaPublicKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, ErrKeyType
+	}
+	xb, err := base64.RawURLEncoding.DecodeString(x)
 	if err != nil {
 		return nil, err
 	}
-	return cert.PublicKey.(*rsa.PublicKey), nil
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(xb),
+		Y:     new(big.Int).SetBytes(yb),
+	}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// ed25519PublicKey returns the Ed25519 public key of the given curve and
+// base64url encoded key.
+func ed25519PublicKey(crv, x string) (ed25519.PublicKey, error) {
+	if crv != "Ed25519" {
+		return nil, ErrKeyType
+	}
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	if len(xb) != ed25519.PublicKeySize {
+		return nil, ErrInvalidKey
+	}
+	return ed25519.PublicKey(xb), nil
+}
+
+// certPublicKey returns the public key of the given base64 encoded DER
+// certificate.
+func certPublicKey(cert string) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(cert)
+	if err != nil {
+		return nil, err
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return c.PublicKey, nil
+}
+
+// keyType returns the JWK key type of the given public key.
+func keyType(key crypto.PublicKey) string {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return KeyTypeRSA
+	case *ecdsa.PublicKey:
+		return KeyTypeEC
+	case ed25519.PublicKey:
+		return KeyTypeOKP
+	}
+	return ""
+}
+
+// keyMatchesAlgorithm returns true if the given public key verifies signatures
+// of the given algorithm.
+func keyMatchesAlgorithm(key crypto.PublicKey, alg string) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case algorithms.RSA_SHA256, algorithms.RSA_SHA384,
+			algorithms.RSA_SHA512, algorithms.RSAPSS_SHA256,
+			algorithms.RSAPSS_SHA384, algorithms.RSAPSS_SHA512:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		switch alg {
+		case algorithms.ECDSA_SHA256:
+			return k.Curve == elliptic.P256()
+		case algorithms.ECDSA_SHA384:
+			return k.Curve == elliptic.P384()
+		case algorithms.ECDSA_SHA512:
+			return k.Curve == elliptic.P521()
+		}
+	case ed25519.PublicKey:
+		return alg == EdDSA
+	}
+	return false
 }
@@ -1,10 +1,15 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/pem"
+	"encoding/base64"
 	"math/big"
 	"net"
 	"testing"
@@ -88,7 +93,7 @@ func newTestTemplate(t *testing.T) *x509.Certificate {
 	return &template
 }
 
-func TestCertPemToRsaPublicKey(t *testing.T) {
+func TestCertPublicKey(t *testing.T) {
 	template := newTestTemplate(t)
 	publicKey, err := algorithms.AlgorithmRS256.PublicKey([]byte(testPublicKey))
 	require.Nil(t, err)
@@ -99,8 +104,107 @@ func TestCertPemToRsaPublicKey(t *testing.T) {
 		publicKey, privateKey,
 	)
 	require.Nil(t, err)
-	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
-	actual, err := certPemToRsaPublicKey(b)
+	actual, err := certPublicKey(base64.StdEncoding.EncodeToString(der))
 	require.Nil(t, err)
 	require.Equal(t, publicKey, actual)
 }
+
+func TestJwkPublicKey(t *testing.T) {
+	rsaKey, err := algorithms.AlgorithmRS256.PublicKey([]byte(testPublicKey))
+	require.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.Nil(t, err)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	tests := []struct {
+		Jwk      jsonWebKey
+		Expected crypto.PublicKey
+		Err      error
+	}{
+		{rsaJwk(rsaKey), rsaKey, nil},
+		{ecJwk(&ecKey.PublicKey), &ecKey.PublicKey, nil},
+		{okpJwk(edKey), edKey, nil},
+		{jsonWebKey{Kty: KeyTypeRSA}, nil, ErrKeyType},
+		{jsonWebKey{Kty: "oct", X: "AAAA"}, nil, ErrKeyType},
+		{jsonWebKey{Kty: KeyTypeRSA, N: "AQAB", E: "AQ"}, nil, ErrInvalidKey},
+		{
+			jsonWebKey{
+				Kty: KeyTypeEC, Crv: "P-256",
+				X: ecJwk(&ecKey.PublicKey).X,
+				Y: ecJwk(&ecKey.PublicKey).Y,
+			},
+			nil, ErrInvalidKey,
+		},
+		{jsonWebKey{Kty: KeyTypeEC, Crv: "secp256k1", X: "AAAA"}, nil, ErrKeyType},
+		{jsonWebKey{Kty: KeyTypeOKP, Crv: "X25519", X: "AAAA"}, nil, ErrKeyType},
+		{jsonWebKey{Kty: KeyTypeOKP, Crv: "Ed25519", X: "AAAA"}, nil, ErrInvalidKey},
+	}
+	for _, test := range tests {
+		actual, err := test.Jwk.PublicKey()
+		require.Equal(t, test.Err, err, "%+v", test.Jwk)
+		require.Equal(t, test.Expected, actual, "%+v", test.Jwk)
+	}
+}
+
+func TestJwkVerifier(t *testing.T) {
+	rsaKey, err := algorithms.AlgorithmRS256.PublicKey([]byte(testPublicKey))
+	require.Nil(t, err)
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	withUseAlg := func(k jsonWebKey, use, alg string) jsonWebKey {
+		k.Use = use
+		k.Alg = alg
+		return k
+	}
+	tests := []struct {
+		Jwk jsonWebKey
+		Alg string
+		Err error
+	}{
+		{rsaJwk(rsaKey), "RS256", nil},
+		{rsaJwk(rsaKey), "PS512", nil},
+		{withUseAlg(rsaJwk(rsaKey), "sig", "RS256"), "RS256", nil},
+		{withUseAlg(rsaJwk(rsaKey), "enc", ""), "RS256", ErrKeyUse},
+		{withUseAlg(rsaJwk(rsaKey), "", "RS384"), "RS256", ErrKeyAlgorithm},
+		{rsaJwk(rsaKey), "HS256", ErrKeyAlgorithm},
+		{rsaJwk(rsaKey), "ES256", ErrKeyAlgorithm},
+		{ecJwk(&p256Key.PublicKey), "ES256", nil},
+		{ecJwk(&p256Key.PublicKey), "ES384", ErrKeyAlgorithm},
+		{ecJwk(&p256Key.PublicKey), "EdDSA", ErrKeyAlgorithm},
+		{okpJwk(edKey), "EdDSA", nil},
+		{okpJwk(edKey), "RS256", ErrKeyAlgorithm},
+	}
+	for _, test := range tests {
+		_, err := test.Jwk.Verifier(test.Alg)
+		require.Equal(t, test.Err, err, "%+v %s", test.Jwk, test.Alg)
+	}
+}
+
+func rsaJwk(k *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: KeyTypeRSA,
+		N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+		E: base64.RawURLEncoding.EncodeToString(
+			big.NewInt(int64(k.E)).Bytes()),
+	}
+}
+
+func ecJwk(k *ecdsa.PublicKey) jsonWebKey {
+	size := (k.Curve.Params().BitSize + 7) / 8
+	return jsonWebKey{
+		Kty: KeyTypeEC,
+		Crv: k.Curve.Params().Name,
+		X:   base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size))),
+		Y:   base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+func okpJwk(k ed25519.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: KeyTypeOKP,
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(k),
+	}
+}
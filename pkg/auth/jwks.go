@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crossedbot/common/golang/logger"
+)
+
+const (
+	// DefaultJwksMaxAge is the time a JWKS document is cached for when its
+	// response sets no expiry
+	DefaultJwksMaxAge = 5 * time.Minute
+
+	// DefaultJwksRefreshInterval is the minimum time between fetches of a
+	// JWKS document forced by unknown key IDs, or retried after errors
+	DefaultJwksRefreshInterval = 30 * time.Second
+
+	// jwksTimeout is the timeout of requests for a JWKS document
+	jwksTimeout = 10 * time.Second
+)
+
+// jwksCache represents an in-process cache of the JWKS document at a URI. The
+// document is fetched again once it expires, per its response's Cache-Control
+// or Expires headers, but no sooner than the refresh interval, or when a key ID
+// is unknown. A single fetch is made at a time, without blocking the use of the
+// cached keys; if it fails, the cached keys continue to be used.
+type jwksCache struct {
+	sync.Mutex
+	uri    string
+	client *http.Client
+	now    func() time.Time
+
+	maxAge          time.Duration // when unset by the response
+	refreshInterval time.Duration
+
+	keys       []jsonWebKey
+	fetched    bool         // set once the document has been fetched
+	expires    time.Time    // of the cached document
+	lastTry    time.Time    // of the last fetch
+	lastErr    error        // of the last fetch, until the document is fetched
+	refreshing *jwksRefresh // the fetch in progress, if any
+}
+
+// jwksRefresh represents a fetch of a JWKS document; done is closed once the
+// fetch has completed, with the fetch's error.
+type jwksRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// newJwksCache returns a new, empty, jwksCache for the given URI.
+func newJwksCache(uri string) *jwksCache {
+	return &jwksCache{
+		uri:             uri,
+		client:          &http.Client{Timeout: jwksTimeout},
+		now:             time.Now,
+		maxAge:          DefaultJwksMaxAge,
+		refreshInterval: DefaultJwksRefreshInterval,
+	}
+}
+
+// Key returns the key of the given ID. Expired documents are fetched again in
+// the background while the cached keys are used. If the key is unknown, or no
+// document is cached, the document is fetched, no more than once per refresh
+// interval, and the fetch waited for.
+func (c *jwksCache) Key(kid string) (jsonWebKey, error) {
+	c.Lock()
+	now := c.now()
+	if !c.fetched {
+		if c.refreshing == nil && now.Sub(c.lastTry) < c.refreshInterval {
+			err := c.lastErr
+			c.Unlock()
+			return jsonWebKey{}, err
+		}
+		return c.wait(c.refresh(now), kid)
+	}
+	if !now.Before(c.expires) {
+		c.refresh(now)
+	}
+	if k, ok := c.find(kid); ok {
+		c.Unlock()
+		return k, nil
+	}
+	// the key may have been rotated in since the document was fetched
+	if c.refreshing != nil || now.Sub(c.lastTry) >= c.refreshInterval {
+		return c.wait(c.refresh(now), kid)
+	}
+	c.Unlock()
+	return jsonWebKey{}, ErrMissingJWKS
+}
+
+// find returns the cached key of the given ID.
+func (c *jwksCache) find(kid string) (jsonWebKey, bool) {
+	for _, k := range c.keys {
+		if k.Kid == kid {
+			return k, true
+		}
+	}
+	return jsonWebKey{}, false
+}
+
+// wait releases the cache's lock, held by the caller, until the given fetch
+// completes, and returns the key of the given ID.
+func (c *jwksCache) wait(r *jwksRefresh, kid string) (jsonWebKey, error) {
+	c.Unlock()
+	<-r.done
+	c.Lock()
+	defer c.Unlock()
+	if !c.fetched {
+		return jsonWebKey{}, r.err
+	}
+	if k, ok := c.find(kid); ok {
+		return k, nil
+	}
+	return jsonWebKey{}, ErrMissingJWKS
+}
+
+// refresh starts fetching the document, unless a fetch is in progress, and
+// returns the fetch in progress. The cache's lock must be held by the caller.
+// If fetching fails and a document is cached, the error is logged and the
+// cached document is used until the next retry.
+func (c *jwksCache) refresh(now time.Time) *jwksRefresh {
+	if c.refreshing != nil {
+		return c.refreshing
+	}
+	r := &jwksRefresh{done: make(chan struct{})}
+	c.refreshing = r
+	c.lastTry = now
+	go func() {
+		keys, maxAge, err := c.fetch(now)
+		c.Lock()
+		defer c.Unlock()
+		defer close(r.done)
+		c.refreshing = nil
+		r.err = err
+		if err != nil {
+			if !c.fetched {
+				c.lastErr = err
+				return
+			}
+			logger.Error(fmt.Sprintf(
+				"Auth: failed to refresh JWKS ('%s'), using cached keys: %s",
+				c.uri, err,
+			))
+			c.expires = now.Add(c.refreshInterval)
+			return
+		}
+		// responses forbidding caching are cached for the refresh
+		// interval, so as to not fetch the document per request
+		if maxAge < c.refreshInterval {
+			maxAge = c.refreshInterval
+		}
+		c.keys = keys
+		c.fetched = true
+		c.lastErr = nil
+		c.expires = now.Add(maxAge)
+	}()
+	return r
+}
+
+// fetch returns the keys of the document, and the time they may be cached for
+// from the given time.
+func (c *jwksCache) fetch(now time.Time) ([]jsonWebKey, time.Duration, error) {
+	resp, err := c.client.Get(c.uri)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf(
+			"unexpected status fetching JWKS: %s", resp.Status)
+	}
+	var jwks jsonWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, 0, err
+	}
+	return jwks.Keys, cacheMaxAge(resp.Header, now, c.maxAge), nil
+}
+
+// cacheMaxAge returns the time a response of the given headers may be cached
+// for, per its Cache-Control or Expires headers. Returns the default if
+// neither is set.
+func cacheMaxAge(h http.Header, now time.Time, def time.Duration) time.Duration {
+	if cc := h.Get("Cache-Control"); cc != "" {
+		maxAge := time.Duration(-1)
+		for _, directive := range strings.Split(cc, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			switch {
+			case directive == "no-store", directive == "no-cache":
+				return 0
+			case strings.HasPrefix(directive, "max-age="):
+				secs, err := strconv.Atoi(
+					strings.TrimPrefix(directive, "max-age="))
+				if err == nil && secs >= 0 {
+					maxAge = time.Duration(secs) * time.Second
+				}
+			}
+		}
+		if maxAge >= 0 {
+			return maxAge
+		}
+	}
+	if exp := h.Get("Expires"); exp != "" {
+		t, err := http.ParseTime(exp)
+		if err != nil || !t.After(now) {
+			// invalid dates represent a time in the past
+			return 0
+		}
+		return t.Sub(now)
+	}
+	return def
+}
@@ -0,0 +1,314 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crossedbot/simplejwt/algorithms"
+	"github.com/stretchr/testify/require"
+)
+
+// testJwksServer represents a JWKS server counting its requests
+type testJwksServer struct {
+	*httptest.Server
+	sync.Mutex
+	keys         []jsonWebKey
+	cacheControl string
+	fail         bool
+	hits         int
+	blocked      chan struct{} // responses wait until closed, if set
+}
+
+func newTestJwksServer(t *testing.T, kids ...string) *testJwksServer {
+	s := &testJwksServer{cacheControl: "max-age=60"}
+	s.setKids(kids...)
+	s.Server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			s.Lock()
+			blocked := s.blocked
+			s.hits++
+			s.Unlock()
+			if blocked != nil {
+				<-blocked
+			}
+			s.Lock()
+			defer s.Unlock()
+			if s.fail {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Cache-Control", s.cacheControl)
+			json.NewEncoder(w).Encode(jsonWebKeySet{Keys: s.keys})
+		},
+	))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testJwksServer) setKids(kids ...string) {
+	s.Lock()
+	defer s.Unlock()
+	s.keys = nil
+	for _, kid := range kids {
+		s.keys = append(s.keys, jsonWebKey{Kid: kid, Kty: KeyTypeRSA})
+	}
+}
+
+func (s *testJwksServer) setFail(fail bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.fail = fail
+}
+
+// block blocks responses until the returned function is called.
+func (s *testJwksServer) block() func() {
+	s.Lock()
+	defer s.Unlock()
+	blocked := make(chan struct{})
+	s.blocked = blocked
+	return func() {
+		s.Lock()
+		defer s.Unlock()
+		s.blocked = nil
+		close(blocked)
+	}
+}
+
+func (s *testJwksServer) Hits() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.hits
+}
+
+// newTestJwksCache returns a jwksCache of the given server, and the function
+// advancing its clock.
+func newTestJwksCache(s *testJwksServer) (*jwksCache, func(time.Duration)) {
+	now := time.Unix(1621000000, 0)
+	c := newJwksCache(s.URL)
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) {
+		c.Lock()
+		defer c.Unlock()
+		now = now.Add(d)
+	}
+}
+
+// waitRefresh waits for the cache's fetch in progress, if any.
+func waitRefresh(c *jwksCache) {
+	c.Lock()
+	r := c.refreshing
+	c.Unlock()
+	if r != nil {
+		<-r.done
+	}
+}
+
+func TestJwksCacheMaxAge(t *testing.T) {
+	s := newTestJwksServer(t, "key1")
+	c, advance := newTestJwksCache(s)
+	for i := 0; i < 3; i++ {
+		k, err := c.Key("key1")
+		require.Nil(t, err)
+		require.Equal(t, "key1", k.Kid)
+	}
+	require.Equal(t, 1, s.Hits())
+	advance(59 * time.Second)
+	_, err := c.Key("key1")
+	require.Nil(t, err)
+	require.Equal(t, 1, s.Hits())
+	// the document is fetched again once expired
+	advance(time.Second)
+	_, err = c.Key("key1")
+	require.Nil(t, err)
+	waitRefresh(c)
+	require.Equal(t, 2, s.Hits())
+}
+
+func TestJwksCacheMinAge(t *testing.T) {
+	s := newTestJwksServer(t, "key1")
+	s.cacheControl = "no-cache"
+	c, advance := newTestJwksCache(s)
+	for i := 0; i < 3; i++ {
+		_, err := c.Key("key1")
+		require.Nil(t, err)
+	}
+	require.Equal(t, 1, s.Hits())
+	// the document is cached for at least the refresh interval
+	advance(DefaultJwksRefreshInterval)
+	_, err := c.Key("key1")
+	require.Nil(t, err)
+	waitRefresh(c)
+	require.Equal(t, 2, s.Hits())
+}
+
+func TestJwksCacheRefreshInBackground(t *testing.T) {
+	s := newTestJwksServer(t, "key1")
+	c, advance := newTestJwksCache(s)
+	_, err := c.Key("key1")
+	require.Nil(t, err)
+	unblock := s.block()
+	advance(time.Minute)
+	// the cached keys are used while the document is fetched, once
+	for i := 0; i < 3; i++ {
+		k, err := c.Key("key1")
+		require.Nil(t, err)
+		require.Equal(t, "key1", k.Kid)
+	}
+	// unknown keys wait for the fetch in progress
+	s.setKids("key1", "key2")
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			k, err := c.Key("key2")
+			require.Nil(t, err)
+			require.Equal(t, "key2", k.Kid)
+		}()
+	}
+	unblock()
+	wg.Wait()
+	require.Equal(t, 2, s.Hits())
+}
+
+func TestJwksCacheUnknownKid(t *testing.T) {
+	s := newTestJwksServer(t, "key1")
+	c, advance := newTestJwksCache(s)
+	_, err := c.Key("key1")
+	require.Nil(t, err)
+	// the key is rotated in after the document was cached
+	s.setKids("key1", "key2")
+	advance(DefaultJwksRefreshInterval)
+	k, err := c.Key("key2")
+	require.Nil(t, err)
+	require.Equal(t, "key2", k.Kid)
+	require.Equal(t, 2, s.Hits())
+	// forced refreshes are rate limited
+	_, err = c.Key("key3")
+	require.Equal(t, ErrMissingJWKS, err)
+	_, err = c.Key("key3")
+	require.Equal(t, ErrMissingJWKS, err)
+	require.Equal(t, 2, s.Hits())
+	advance(DefaultJwksRefreshInterval)
+	_, err = c.Key("key3")
+	require.Equal(t, ErrMissingJWKS, err)
+	require.Equal(t, 3, s.Hits())
+}
+
+func TestJwksCacheStaleWhileError(t *testing.T) {
+	s := newTestJwksServer(t, "key1")
+	c, advance := newTestJwksCache(s)
+	_, err := c.Key("key1")
+	require.Nil(t, err)
+	s.setFail(true)
+	advance(time.Minute)
+	k, err := c.Key("key1")
+	require.Nil(t, err)
+	require.Equal(t, "key1", k.Kid)
+	waitRefresh(c)
+	require.Equal(t, 2, s.Hits())
+	// failed fetches are retried after the refresh interval
+	_, err = c.Key("key1")
+	require.Nil(t, err)
+	require.Equal(t, 2, s.Hits())
+	s.setFail(false)
+	advance(DefaultJwksRefreshInterval)
+	_, err = c.Key("key1")
+	require.Nil(t, err)
+	waitRefresh(c)
+	require.Equal(t, 3, s.Hits())
+}
+
+func TestJwksCacheError(t *testing.T) {
+	s := newTestJwksServer(t, "key1")
+	s.setFail(true)
+	c, advance := newTestJwksCache(s)
+	_, err := c.Key("key1")
+	require.NotNil(t, err)
+	s.setFail(false)
+	// failed fetches are retried after the refresh interval
+	_, err = c.Key("key1")
+	require.NotNil(t, err)
+	require.Equal(t, 1, s.Hits())
+	advance(DefaultJwksRefreshInterval)
+	_, err = c.Key("key1")
+	require.Nil(t, err)
+	require.Equal(t, 2, s.Hits())
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	now := time.Unix(1621000000, 0)
+	tests := []struct {
+		Header   http.Header
+		Expected time.Duration
+	}{
+		{http.Header{}, DefaultJwksMaxAge},
+		{
+			http.Header{"Cache-Control": {"public, max-age=120"}},
+			2 * time.Minute,
+		},
+		{http.Header{"Cache-Control": {"no-store"}}, 0},
+		{http.Header{"Cache-Control": {"max-age=60, no-cache"}}, 0},
+		{
+			http.Header{
+				"Cache-Control": {"public"},
+				"Expires": {
+					now.Add(time.Hour).UTC().Format(http.TimeFormat),
+				},
+			},
+			time.Hour,
+		},
+		{
+			http.Header{
+				"Cache-Control": {"max-age=60"},
+				"Expires": {
+					now.Add(time.Hour).UTC().Format(http.TimeFormat),
+				},
+			},
+			time.Minute,
+		},
+		{http.Header{"Expires": {"0"}}, 0},
+	}
+	for _, test := range tests {
+		actual := cacheMaxAge(test.Header, now, DefaultJwksMaxAge)
+		require.Equal(t, test.Expected, actual, test.Header)
+	}
+}
+
+func TestJwksKeyFunc(t *testing.T) {
+	template := newTestTemplate(t)
+	publicKey, err := algorithms.AlgorithmRS256.PublicKey([]byte(testPublicKey))
+	require.Nil(t, err)
+	privateKey, err := algorithms.AlgorithmRS256.PrivateKey([]byte(testPrivateKey))
+	require.Nil(t, err)
+	der, err := x509.CreateCertificate(
+		rand.Reader,
+		template, template,
+		publicKey, privateKey,
+	)
+	require.Nil(t, err)
+	s := newTestJwksServer(t)
+	s.keys = []jsonWebKey{{
+		Kid: "key1",
+		Kty: KeyTypeRSA,
+		X5C: []string{base64.StdEncoding.EncodeToString(der)},
+	}}
+	keyFunc := JwksKeyFunc(s.URL)
+	for i := 0; i < 2; i++ {
+		key, err := keyFunc("key1", "RS256")
+		require.Nil(t, err)
+		require.Equal(t, publicKey, key)
+	}
+	require.Equal(t, 1, s.Hits())
+	_, err = keyFunc("key1", "ES256")
+	require.Equal(t, ErrKeyAlgorithm, err)
+	_, err = keyFunc("unknown", "RS256")
+	require.Equal(t, ErrMissingJWKS, err)
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// OidcDiscoveryPath is the path, relative to an issuer, of its OpenID
+	// Provider configuration
+	OidcDiscoveryPath = "/.well-known/openid-configuration"
+)
+
+// oidcConfiguration represents the OpenID Provider configuration document
+// fields used by axis.
+type oidcConfiguration struct {
+	Issuer  string `json:"issuer"`
+	JwksUri string `json:"jwks_uri"`
+}
+
+// OidcKeyFunc returns the KeyFunc retrieving public keys from the JWKS document
+// of the given issuer, as discovered via its OpenID Provider configuration.
+// Discovery happens on first use, and is retried, no more than once per refresh
+// interval, until it succeeds. Concurrent callers wait for the discovery in
+// progress, if any.
+var OidcKeyFunc = func(issuer string) KeyFunc {
+	var mu sync.Mutex
+	var keyFunc KeyFunc
+	var discovering chan struct{} // closed once the discovery completes
+	var lastTry time.Time
+	var lastErr error
+	return func(kid, alg string) (crypto.PublicKey, error) {
+		mu.Lock()
+		if keyFunc == nil && discovering == nil {
+			now := time.Now()
+			if lastErr != nil &&
+				now.Sub(lastTry) < DefaultJwksRefreshInterval {
+				mu.Unlock()
+				return nil, lastErr
+			}
+			lastTry = now
+			done := make(chan struct{})
+			discovering = done
+			// the lock is not held while discovering, so as to not
+			// block callers on the request
+			go func() {
+				jwksUri, err := discoverJwksUri(issuer)
+				mu.Lock()
+				defer mu.Unlock()
+				defer close(done)
+				discovering = nil
+				if err != nil {
+					lastErr = fmt.Errorf(
+						"failed to discover JWKS of issuer ('%s'): %s",
+						issuer, err,
+					)
+					return
+				}
+				keyFunc = JwksKeyFunc(jwksUri)
+				lastErr = nil
+			}()
+		}
+		if keyFunc == nil {
+			done := discovering
+			mu.Unlock()
+			<-done
+			mu.Lock()
+		}
+		fn, err := keyFunc, lastErr
+		mu.Unlock()
+		if fn == nil {
+			return nil, err
+		}
+		return fn(kid, alg)
+	}
+}
+
+// discoverJwksUri returns the JWKS URI of the given issuer's OpenID Provider
+// configuration.
+func discoverJwksUri(issuer string) (string, error) {
+	client := &http.Client{Timeout: jwksTimeout}
+	uri := strings.TrimSuffix(issuer, "/") + OidcDiscoveryPath
+	resp, err := client.Get(uri)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(
+			"unexpected status fetching OpenID configuration: %s",
+			resp.Status,
+		)
+	}
+	var cfg oidcConfiguration
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		return "", err
+	}
+	// the issuer must be identical to the one the configuration was
+	// retrieved for, per OpenID Connect Discovery 1.0 section 4.3
+	if cfg.Issuer != issuer {
+		return "", fmt.Errorf(
+			"issuer ('%s') does not match configuration", cfg.Issuer)
+	}
+	if cfg.JwksUri == "" {
+		return "", fmt.Errorf("configuration is missing jwks_uri")
+	}
+	return cfg.JwksUri, nil
+}
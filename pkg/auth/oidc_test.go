@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/crossedbot/simplejwt/algorithms"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOidcServer(t *testing.T, keys ...jsonWebKey) *httptest.Server {
+	mux := http.NewServeMux()
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	mux.HandleFunc(OidcDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcConfiguration{
+			Issuer:  s.URL,
+			JwksUri: s.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jsonWebKeySet{Keys: keys})
+	})
+	return s
+}
+
+func TestDiscoverJwksUri(t *testing.T) {
+	s := newTestOidcServer(t)
+	actual, err := discoverJwksUri(s.URL)
+	require.Nil(t, err)
+	require.Equal(t, s.URL+"/keys", actual)
+	// the issuer must match the configuration
+	_, err = discoverJwksUri(s.URL + "/")
+	require.NotNil(t, err)
+	_, err = discoverJwksUri(s.URL + "/other")
+	require.NotNil(t, err)
+}
+
+func TestOidcKeyFunc(t *testing.T) {
+	publicKey, err := algorithms.AlgorithmRS256.PublicKey([]byte(testPublicKey))
+	require.Nil(t, err)
+	k := rsaJwk(publicKey)
+	k.Kid = "key1"
+	s := newTestOidcServer(t, k)
+	keyFunc := OidcKeyFunc(s.URL)
+	actual, err := keyFunc("key1", "RS256")
+	require.Nil(t, err)
+	require.Equal(t, publicKey, actual)
+	_, err = keyFunc("key2", "RS256")
+	require.Equal(t, ErrMissingJWKS, err)
+	// failed discovery is not retried until the refresh interval passes
+	keyFunc = OidcKeyFunc(s.URL + "/other")
+	_, err = keyFunc("key1", "RS256")
+	require.NotNil(t, err)
+	s.Close()
+	_, err2 := keyFunc("key1", "RS256")
+	require.Equal(t, err, err2)
+}
+
+func TestOidcKeyFuncConcurrent(t *testing.T) {
+	publicKey, err := algorithms.AlgorithmRS256.PublicKey([]byte(testPublicKey))
+	require.Nil(t, err)
+	k := rsaJwk(publicKey)
+	k.Kid = "key1"
+	var discoveries int32
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	mux.HandleFunc(OidcDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&discoveries, 1)
+		<-release
+		json.NewEncoder(w).Encode(oidcConfiguration{
+			Issuer:  s.URL,
+			JwksUri: s.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jsonWebKeySet{Keys: []jsonWebKey{k}})
+	})
+	keyFunc := OidcKeyFunc(s.URL)
+	// callers wait for the discovery in progress, rather than each
+	// discovering the JWKS document
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := keyFunc("key1", "RS256")
+			errs <- err
+		}()
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.Nil(t, err)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&discoveries))
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/crossedbot/common/golang/server"
+	jwt "github.com/crossedbot/simplejwt"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+// List of scopes required by the routes of the HTTP API
+const (
+	ScopePinsRead   = "pins:read"
+	ScopePinsWrite  = "pins:write"
+	ScopePinsDelete = "pins:delete"
+	ScopeAdmin      = "admin"
+)
+
+// requireScopes rejects tokens without scopes; otherwise such tokens hold
+// every scope but the admin scope
+var requireScopes bool
+var SetRequireScopes = func(require bool) {
+	requireScopes = require
+}
+
+// scopesContextKey is the key of the request context value holding the scopes
+// of the request's token
+type scopesContextKey struct{}
+
+// RequestScopes returns the scopes of the token the given request was
+// authenticated by. Returns nil if the token has no scopes.
+func RequestScopes(r *http.Request) []string {
+	scopes, _ := r.Context().Value(scopesContextKey{}).([]string)
+	return scopes
+}
+
+// withScopes returns the given context holding the given scopes.
+func withScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesContextKey{}, scopes)
+}
+
+// claimScopes returns the scopes of the given claims; either the space
+// delimited scope claim, per RFC 8693, or the scp claim, a list or a space
+// delimited string.
+func claimScopes(claims jwt.CustomClaims) []string {
+	if scope, ok := claims.Get("scope").(string); ok {
+		return strings.Fields(scope)
+	}
+	switch scp := claims.Get("scp").(type) {
+	case string:
+		return strings.Fields(scp)
+	case []interface{}:
+		scopes := []string{}
+		for _, v := range scp {
+			if s, ok := v.(string); ok && s != "" {
+				scopes = append(scopes, s)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
+
+// missingScopes returns the required scopes missing from the given scopes of
+// a token. Unless scopes are required, a token without scopes holds every
+// scope but the admin scope, which must always be held explicitly.
+func missingScopes(scopes, required []string) []string {
+	unrestricted := len(scopes) == 0 && !requireScopes
+	missing := []string{}
+	for _, r := range required {
+		if unrestricted && r != ScopeAdmin {
+			continue
+		}
+		found := false
+		for _, s := range scopes {
+			if s == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// insufficientScope writes the forbidden failure response for the given
+// missing scopes.
+func insufficientScope(w http.ResponseWriter, missing []string) {
+	scope := strings.Join(missing, " ")
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+		"Bearer error=\"insufficient_scope\", scope=\"%s\"", scope))
+	server.JsonResponse(w, models.NewFailure(
+		models.ErrForbiddenCode,
+		fmt.Sprintf("%s; missing scope: %s", ErrInsufficientScope, scope),
+	), http.StatusForbidden)
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/crossedbot/common/golang/server"
+	jwt "github.com/crossedbot/simplejwt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+func TestClaimScopes(t *testing.T) {
+	tests := []struct {
+		Claims   jwt.CustomClaims
+		Expected []string
+	}{
+		{jwt.CustomClaims{}, nil},
+		{jwt.CustomClaims{"scope": "pins:read  pins:write"}, []string{"pins:read", "pins:write"}},
+		{jwt.CustomClaims{"scp": "admin"}, []string{"admin"}},
+		{jwt.CustomClaims{"scp": []interface{}{"pins:read", 1, ""}}, []string{"pins:read"}},
+		// the scope claim takes precedence
+		{jwt.CustomClaims{"scope": "admin", "scp": "pins:read"}, []string{"admin"}},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.Expected, claimScopes(test.Claims))
+	}
+}
+
+func TestMissingScopes(t *testing.T) {
+	defer SetRequireScopes(false)
+	required := []string{ScopePinsRead, ScopePinsWrite}
+	require.Empty(t, missingScopes(nil, required))
+	require.Empty(t, missingScopes([]string{ScopePinsWrite, ScopePinsRead}, required))
+	require.Equal(t, []string{ScopePinsWrite},
+		missingScopes([]string{ScopePinsRead}, required))
+	// the admin scope is never implied
+	require.Equal(t, []string{ScopeAdmin},
+		missingScopes(nil, []string{ScopePinsRead, ScopeAdmin}))
+	require.Empty(t, missingScopes([]string{ScopeAdmin}, []string{ScopeAdmin}))
+	SetRequireScopes(true)
+	require.Equal(t, required, missingScopes(nil, required))
+	require.Empty(t, missingScopes(nil, nil))
+}
+
+func TestAuthorizeScopes(t *testing.T) {
+	signers := newTestSigners(t)
+	defaultKeyFunc := keyFunc
+	SetKeyFunc(testKeyFunc(signers))
+	defer SetKeyFunc(defaultKeyFunc)
+	handler := Authorize(func(w http.ResponseWriter, r *http.Request, p server.Parameters) {
+		w.WriteHeader(http.StatusOK)
+	}, ScopePinsDelete)
+	tkn := signTestToken(t, signers["rsa"], "rsa", jwt.CustomClaims{
+		"uid":   "myuserid",
+		"grant": "user",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "pins:read",
+	})
+	r := httptest.NewRequest(http.MethodDelete, "/pins/abc", nil)
+	r.Header.Set("Authorization", "Bearer "+tkn)
+	rr := httptest.NewRecorder()
+	handler(rr, r, server.Parameters{})
+	require.Equal(t, http.StatusForbidden, rr.Code)
+	require.Equal(t,
+		`Bearer error="insufficient_scope", scope="pins:delete"`,
+		rr.Header().Get("WWW-Authenticate"))
+	var failure models.Failure
+	require.Nil(t, json.NewDecoder(rr.Body).Decode(&failure))
+	require.Equal(t, models.ErrorCodeStrings[models.ErrForbiddenCode], failure.Error.Reason)
+	require.Contains(t, failure.Error.Details, ScopePinsDelete)
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	jwt "github.com/crossedbot/simplejwt"
+	"github.com/crossedbot/simplejwt/algorithms"
+)
+
+// KeyFunc represents a function returning the public key of the given key ID,
+// for verifying tokens signed with the given algorithm.
+type KeyFunc func(kid, alg string) (crypto.PublicKey, error)
+
+// signingAlgorithm returns the signing algorithm of the given name.
+func signingAlgorithm(name string) (algorithms.SigningAlgorithm, error) {
+	if name == EdDSA {
+		return AlgorithmEdDSA, nil
+	}
+	return jwt.GetSigningAlgorithm(name)
+}
+
+// parseToken returns the token parsed from the given string. Unlike jwt.Parse,
+// tokens signed with EdDSA are supported.
+func parseToken(s string) (*jwt.Token, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	t := new(jwt.Token)
+	if err := decodeSegment(parts[0], &t.Header); err != nil {
+		return nil, err
+	}
+	var claims jwt.CustomClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	t.Claims = claims
+	name, ok := t.Header["alg"].(string)
+	if !ok {
+		return nil, jwt.ErrAlgMissing
+	}
+	alg, err := signingAlgorithm(name)
+	if err != nil {
+		return nil, err
+	}
+	t.Algorithm = alg
+	t.Data = strings.Join(parts[:2], ".")
+	t.Signature = parts[2]
+	return t, nil
+}
+
+// verifyToken returns the claims of the given token, if its signature is valid
+// for the key returned by the given KeyFunc and its claims are valid per the
+// given policy.
+func verifyToken(s string, keyFunc KeyFunc, policy ClaimsPolicy) (jwt.CustomClaims, error) {
+	t, err := parseToken(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %s", err)
+	}
+	kid, _ := t.Header["kid"].(string)
+	key, err := keyFunc(kid, t.Algorithm.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %s", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %s", err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	sig, err := base64.RawURLEncoding.DecodeString(
+		strings.TrimRight(t.Signature, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization token: %s", err)
+	}
+	if err := t.Algorithm.Valid(t.Data, sig, pemKey); err != nil {
+		return nil, fmt.Errorf("invalid authorization token: %s", err)
+	}
+	claims := t.Claims.(jwt.CustomClaims)
+	if err := policy.Valid(claims, time.Now()); err != nil {
+		return nil, fmt.Errorf("invalid authorization token: %s", err)
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes the given base64url encoded JSON segment of a token
+// into v.
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
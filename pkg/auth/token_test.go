@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/crossedbot/common/golang/server"
+	jwt "github.com/crossedbot/simplejwt"
+	"github.com/crossedbot/simplejwt/algorithms"
+	middleware "github.com/crossedbot/simplemiddleware"
+	"github.com/stretchr/testify/require"
+)
+
+// testSigner represents a signing key and its JWK
+type testSigner struct {
+	alg        algorithms.SigningAlgorithm
+	privateKey []byte // PEM encoded
+	jwk        jsonWebKey
+}
+
+func newTestSigners(t *testing.T) map[string]testSigner {
+	rsaKey, err := algorithms.AlgorithmRS256.PublicKey([]byte(testPublicKey))
+	require.Nil(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	ecDer, err := x509.MarshalECPrivateKey(ecKey)
+	require.Nil(t, err)
+	edPublicKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	edDer, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.Nil(t, err)
+	return map[string]testSigner{
+		"rsa": {
+			alg:        algorithms.AlgorithmRS256,
+			privateKey: []byte(testPrivateKey),
+			jwk:        rsaJwk(rsaKey),
+		},
+		"ec": {
+			alg: algorithms.AlgorithmEC256,
+			privateKey: pem.EncodeToMemory(
+				&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDer}),
+			jwk: ecJwk(&ecKey.PublicKey),
+		},
+		"ed25519": {
+			alg: AlgorithmEdDSA,
+			privateKey: pem.EncodeToMemory(
+				&pem.Block{Type: "PRIVATE KEY", Bytes: edDer}),
+			jwk: okpJwk(edPublicKey),
+		},
+	}
+}
+
+func testKeyFunc(signers map[string]testSigner) KeyFunc {
+	return func(kid, alg string) (crypto.PublicKey, error) {
+		s, ok := signers[kid]
+		if !ok {
+			return nil, ErrMissingJWKS
+		}
+		return s.jwk.Verifier(alg)
+	}
+}
+
+func signTestToken(t *testing.T, s testSigner, kid string, claims jwt.CustomClaims) string {
+	tkn := jwt.New(claims, s.alg)
+	tkn.Header["kid"] = kid
+	signed, err := tkn.Sign(s.privateKey)
+	require.Nil(t, err)
+	return signed
+}
+
+func TestVerifyToken(t *testing.T) {
+	signers := newTestSigners(t)
+	keyFunc := testKeyFunc(signers)
+	claims := jwt.CustomClaims{
+		"uid": "myuserid",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for kid, s := range signers {
+		actual, err := verifyToken(signTestToken(t, s, kid, claims), keyFunc, ClaimsPolicy{})
+		require.Nil(t, err, kid)
+		require.Equal(t, "myuserid", actual.Get("uid"), kid)
+	}
+	// signed by another key
+	tkn := signTestToken(t, signers["rsa"], "ec", claims)
+	_, err := verifyToken(tkn, keyFunc, ClaimsPolicy{})
+	require.NotNil(t, err)
+	// signed with the wrong key
+	edKey := signers["ed25519"]
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(other)
+	require.Nil(t, err)
+	edKey.privateKey = pem.EncodeToMemory(
+		&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	tkn = signTestToken(t, edKey, "ed25519", claims)
+	_, err = verifyToken(tkn, keyFunc, ClaimsPolicy{})
+	require.NotNil(t, err)
+	// symmetric algorithms are never accepted
+	tkn = signTestToken(t, testSigner{
+		alg:        algorithms.AlgorithmHS256,
+		privateKey: []byte(testPublicKey),
+	}, "rsa", claims)
+	_, err = verifyToken(tkn, keyFunc, ClaimsPolicy{})
+	require.NotNil(t, err)
+	// expired
+	tkn = signTestToken(t, signers["ed25519"], "ed25519", jwt.CustomClaims{
+		"uid": "myuserid",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+	_, err = verifyToken(tkn, keyFunc, ClaimsPolicy{})
+	require.NotNil(t, err)
+	for _, s := range []string{"", "a.b", "a.b.c"} {
+		_, err = verifyToken(s, keyFunc, ClaimsPolicy{})
+		require.NotNil(t, err, s)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	signers := newTestSigners(t)
+	defaultKeyFunc := keyFunc
+	SetKeyFunc(testKeyFunc(signers))
+	defer SetKeyFunc(defaultKeyFunc)
+	var userId interface{}
+	handler := Authorize(func(w http.ResponseWriter, r *http.Request, p server.Parameters) {
+		userId = r.Context().Value(middleware.ClaimUserId)
+		w.WriteHeader(http.StatusOK)
+	})
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		Header   string
+		Expected int
+	}{
+		{
+			"Bearer " + signTestToken(t, signers["ed25519"], "ed25519",
+				jwt.CustomClaims{"uid": "myuserid", "grant": "user", "exp": exp}),
+			http.StatusOK,
+		},
+		{
+			"Bearer " + signTestToken(t, signers["ec"], "ec",
+				jwt.CustomClaims{"uid": "myuserid", "exp": exp}),
+			http.StatusUnauthorized,
+		},
+		{
+			"Bearer " + signTestToken(t, signers["ec"], "rsa",
+				jwt.CustomClaims{"uid": "myuserid", "grant": "user", "exp": exp}),
+			http.StatusUnauthorized,
+		},
+		{"", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		userId = nil
+		r := httptest.NewRequest(http.MethodGet, "/pins", nil)
+		r.Header.Set("Authorization", test.Header)
+		rr := httptest.NewRecorder()
+		handler(rr, r, server.Parameters{})
+		require.Equal(t, test.Expected, rr.Code, test.Header)
+		if test.Expected == http.StatusOK {
+			require.Equal(t, "myuserid", userId)
+		}
+	}
+}
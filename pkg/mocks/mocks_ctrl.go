@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	io "io"
 	reflect "reflect"
 
 	models "github.com/crossedbot/axis/pkg/pins/models"
@@ -34,6 +35,36 @@ func (m *MockController) EXPECT() *MockControllerMockRecorder {
 	return m.recorder
 }
 
+// AuthenticateApiKey mocks base method.
+func (m *MockController) AuthenticateApiKey(key string) (models.ApiKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuthenticateApiKey", key)
+	ret0, _ := ret[0].(models.ApiKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AuthenticateApiKey indicates an expected call of AuthenticateApiKey.
+func (mr *MockControllerMockRecorder) AuthenticateApiKey(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthenticateApiKey", reflect.TypeOf((*MockController)(nil).AuthenticateApiKey), key)
+}
+
+// CreateApiKey mocks base method.
+func (m *MockController) CreateApiKey(uid, grant string, scopes []string, name string) (models.ApiKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateApiKey", uid, grant, scopes, name)
+	ret0, _ := ret[0].(models.ApiKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateApiKey indicates an expected call of CreateApiKey.
+func (mr *MockControllerMockRecorder) CreateApiKey(uid, grant, scopes, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateApiKey", reflect.TypeOf((*MockController)(nil).CreateApiKey), uid, grant, scopes, name)
+}
+
 // CreatePin mocks base method.
 func (m *MockController) CreatePin(uid string, pin models.Pin) (models.PinStatus, error) {
 	m.ctrl.T.Helper()
@@ -49,19 +80,64 @@ func (mr *MockControllerMockRecorder) CreatePin(uid, pin interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePin", reflect.TypeOf((*MockController)(nil).CreatePin), uid, pin)
 }
 
+// ExportPins mocks base method.
+func (m *MockController) ExportPins(w io.Writer, cids []string, name, before, after string, match models.TextMatch, statuses []models.Status, meta models.Info) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportPins", w, cids, name, before, after, match, statuses, meta)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportPins indicates an expected call of ExportPins.
+func (mr *MockControllerMockRecorder) ExportPins(w, cids, name, before, after, match, statuses, meta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportPins", reflect.TypeOf((*MockController)(nil).ExportPins), w, cids, name, before, after, match, statuses, meta)
+}
+
+// FindApiKeys mocks base method.
+func (m *MockController) FindApiKeys(uid string) (models.ApiKeys, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindApiKeys", uid)
+	ret0, _ := ret[0].(models.ApiKeys)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindApiKeys indicates an expected call of FindApiKeys.
+func (mr *MockControllerMockRecorder) FindApiKeys(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindApiKeys", reflect.TypeOf((*MockController)(nil).FindApiKeys), uid)
+}
+
 // FindPins mocks base method.
-func (m *MockController) FindPins(uid string, cids []string, name, before, after string, match models.TextMatch, statuses []models.Status, limit, offset int, sortBy string, meta models.Info) (models.Pins, error) {
+func (m *MockController) FindPins(uid string, cids []string, name, before, after string, match models.TextMatch, statuses []models.Status, limit, offset int, cursor, sortBy string, meta models.Info) (models.Pins, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindPins", uid, cids, name, before, after, match, statuses, limit, offset, sortBy, meta)
+	ret := m.ctrl.Call(m, "FindPins", uid, cids, name, before, after, match, statuses, limit, offset, cursor, sortBy, meta)
 	ret0, _ := ret[0].(models.Pins)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // FindPins indicates an expected call of FindPins.
-func (mr *MockControllerMockRecorder) FindPins(uid, cids, name, before, after, match, statuses, limit, offset, sortBy, meta interface{}) *gomock.Call {
+func (mr *MockControllerMockRecorder) FindPins(uid, cids, name, before, after, match, statuses, limit, offset, cursor, sortBy, meta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindPins", reflect.TypeOf((*MockController)(nil).FindPins), uid, cids, name, before, after, match, statuses, limit, offset, cursor, sortBy, meta)
+}
+
+// GetReconciliation mocks base method.
+func (m *MockController) GetReconciliation() (models.Reconciliation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReconciliation")
+	ret0, _ := ret[0].(models.Reconciliation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReconciliation indicates an expected call of GetReconciliation.
+func (mr *MockControllerMockRecorder) GetReconciliation() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindPins", reflect.TypeOf((*MockController)(nil).FindPins), uid, cids, name, before, after, match, statuses, limit, offset, sortBy, meta)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReconciliation", reflect.TypeOf((*MockController)(nil).GetReconciliation))
 }
 
 // GetPin mocks base method.
@@ -79,6 +155,21 @@ func (mr *MockControllerMockRecorder) GetPin(uid, id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPin", reflect.TypeOf((*MockController)(nil).GetPin), uid, id)
 }
 
+// ImportPins mocks base method.
+func (m *MockController) ImportPins(r io.Reader, repin, overwrite bool) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportPins", r, repin, overwrite)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImportPins indicates an expected call of ImportPins.
+func (mr *MockControllerMockRecorder) ImportPins(r, repin, overwrite interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportPins", reflect.TypeOf((*MockController)(nil).ImportPins), r, repin, overwrite)
+}
+
 // PatchPin mocks base method.
 func (m *MockController) PatchPin(uid, id string, data models.Pin) (models.PinStatus, error) {
 	m.ctrl.T.Helper()
@@ -108,6 +199,20 @@ func (mr *MockControllerMockRecorder) RemovePin(uid, id interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemovePin", reflect.TypeOf((*MockController)(nil).RemovePin), uid, id)
 }
 
+// RevokeApiKey mocks base method.
+func (m *MockController) RevokeApiKey(uid, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeApiKey", uid, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeApiKey indicates an expected call of RevokeApiKey.
+func (mr *MockControllerMockRecorder) RevokeApiKey(uid, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeApiKey", reflect.TypeOf((*MockController)(nil).RevokeApiKey), uid, id)
+}
+
 // UpdatePin mocks base method.
 func (m *MockController) UpdatePin(uid, id string, data models.Pin) (models.PinStatus, error) {
 	m.ctrl.T.Helper()
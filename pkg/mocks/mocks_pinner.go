@@ -6,6 +6,7 @@ package mocks
 
 import (
 	reflect "reflect"
+	time "time"
 
 	models "github.com/crossedbot/axis/pkg/pins/models"
 	gomock "github.com/golang/mock/gomock"
@@ -103,3 +104,31 @@ func (mr *MockPinnerMockRecorder) SetReplicationFactor(min, max interface{}) *go
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReplicationFactor", reflect.TypeOf((*MockPinner)(nil).SetReplicationFactor), min, max)
 }
+
+// SetRetries mocks base method.
+func (m *MockPinner) SetRetries(retries int, backoff time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRetries", retries, backoff)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetRetries indicates an expected call of SetRetries.
+func (mr *MockPinnerMockRecorder) SetRetries(retries, backoff interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRetries", reflect.TypeOf((*MockPinner)(nil).SetRetries), retries, backoff)
+}
+
+// Update mocks base method.
+func (m *MockPinner) Update(from string, pin models.Pin) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", from, pin)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockPinnerMockRecorder) Update(from, pin interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockPinner)(nil).Update), from, pin)
+}
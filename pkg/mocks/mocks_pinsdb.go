@@ -49,19 +49,48 @@ func (mr *MockPinsMockRecorder) Delete(id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockPins)(nil).Delete), id)
 }
 
+// DeleteApiKey mocks base method.
+func (m *MockPins) DeleteApiKey(owner, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteApiKey", owner, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteApiKey indicates an expected call of DeleteApiKey.
+func (mr *MockPinsMockRecorder) DeleteApiKey(owner, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteApiKey", reflect.TypeOf((*MockPins)(nil).DeleteApiKey), owner, id)
+}
+
 // Find mocks base method.
-func (m *MockPins) Find(cids, statuses []string, name string, before, after int64, match string, limit, offset int, sortBy *database.SortingKey, meta models.Info) (models.Pins, error) {
+func (m *MockPins) Find(owner string, cids, statuses []string, name string, before, after int64, match string, limit, offset int, cursor *database.Cursor, sortBy *database.SortingKey, meta models.Info) (models.Pins, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Find", cids, statuses, name, before, after, match, limit, offset, sortBy, meta)
+	ret := m.ctrl.Call(m, "Find", owner, cids, statuses, name, before, after, match, limit, offset, cursor, sortBy, meta)
 	ret0, _ := ret[0].(models.Pins)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Find indicates an expected call of Find.
-func (mr *MockPinsMockRecorder) Find(cids, statuses, name, before, after, match, limit, offset, sortBy, meta interface{}) *gomock.Call {
+func (mr *MockPinsMockRecorder) Find(owner, cids, statuses, name, before, after, match, limit, offset, cursor, sortBy, meta interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockPins)(nil).Find), owner, cids, statuses, name, before, after, match, limit, offset, cursor, sortBy, meta)
+}
+
+// FindApiKeys mocks base method.
+func (m *MockPins) FindApiKeys(owner string) ([]models.ApiKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindApiKeys", owner)
+	ret0, _ := ret[0].([]models.ApiKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindApiKeys indicates an expected call of FindApiKeys.
+func (mr *MockPinsMockRecorder) FindApiKeys(owner interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockPins)(nil).Find), cids, statuses, name, before, after, match, limit, offset, sortBy, meta)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindApiKeys", reflect.TypeOf((*MockPins)(nil).FindApiKeys), owner)
 }
 
 // Get mocks base method.
@@ -79,6 +108,21 @@ func (mr *MockPinsMockRecorder) Get(id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockPins)(nil).Get), id)
 }
 
+// GetApiKey mocks base method.
+func (m *MockPins) GetApiKey(hash string) (models.ApiKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetApiKey", hash)
+	ret0, _ := ret[0].(models.ApiKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetApiKey indicates an expected call of GetApiKey.
+func (mr *MockPinsMockRecorder) GetApiKey(hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetApiKey", reflect.TypeOf((*MockPins)(nil).GetApiKey), hash)
+}
+
 // Patch mocks base method.
 func (m *MockPins) Patch(id string, fields map[string]interface{}) error {
 	m.ctrl.T.Helper()
@@ -93,6 +137,21 @@ func (mr *MockPinsMockRecorder) Patch(id, fields interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Patch", reflect.TypeOf((*MockPins)(nil).Patch), id, fields)
 }
 
+// References mocks base method.
+func (m *MockPins) References(cid string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "References", cid)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// References indicates an expected call of References.
+func (mr *MockPinsMockRecorder) References(cid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "References", reflect.TypeOf((*MockPins)(nil).References), cid)
+}
+
 // Set mocks base method.
 func (m *MockPins) Set(pinStatus models.PinStatus) error {
 	m.ctrl.T.Helper()
@@ -106,3 +165,17 @@ func (mr *MockPinsMockRecorder) Set(pinStatus interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockPins)(nil).Set), pinStatus)
 }
+
+// SetApiKey mocks base method.
+func (m *MockPins) SetApiKey(key models.ApiKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetApiKey", key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetApiKey indicates an expected call of SetApiKey.
+func (mr *MockPinsMockRecorder) SetApiKey(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetApiKey", reflect.TypeOf((*MockPins)(nil).SetApiKey), key)
+}
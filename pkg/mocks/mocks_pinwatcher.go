@@ -6,7 +6,6 @@ package mocks
 
 import (
 	reflect "reflect"
-	time "time"
 
 	models "github.com/crossedbot/axis/pkg/pins/models"
 	gomock "github.com/golang/mock/gomock"
@@ -49,13 +48,27 @@ func (mr *MockPinWatcherMockRecorder) Deregister(pid interface{}) *gomock.Call {
 }
 
 // Register mocks base method.
-func (m *MockPinWatcher) Register(p models.PinStatus, targetStatus api.TrackerStatus, checkFreq time.Duration) {
+func (m *MockPinWatcher) Register(p models.PinStatus, targetStatus api.TrackerStatus, onTarget func(models.PinStatus)) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Register", p, targetStatus, checkFreq)
+	m.ctrl.Call(m, "Register", p, targetStatus, onTarget)
 }
 
 // Register indicates an expected call of Register.
-func (mr *MockPinWatcherMockRecorder) Register(p, targetStatus, checkFreq interface{}) *gomock.Call {
+func (mr *MockPinWatcherMockRecorder) Register(p, targetStatus, onTarget interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockPinWatcher)(nil).Register), p, targetStatus, checkFreq)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockPinWatcher)(nil).Register), p, targetStatus, onTarget)
+}
+
+// Restore mocks base method.
+func (m *MockPinWatcher) Restore(onTarget func(models.PinStatus)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", onTarget)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Restore indicates an expected call of Restore.
+func (mr *MockPinWatcherMockRecorder) Restore(onTarget interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockPinWatcher)(nil).Restore), onTarget)
 }
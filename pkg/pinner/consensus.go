@@ -0,0 +1,140 @@
+package pinner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
+)
+
+// Consensus represents the agreement required among the cluster peers
+// allocated to a pin for the pin to be considered pinned.
+type Consensus string
+
+const (
+	// ConsensusAny requires any allocated peer to have pinned the content
+	ConsensusAny Consensus = "any"
+	// ConsensusReplicationMin requires the minimum replication factor of
+	// allocated peers to have pinned the content
+	ConsensusReplicationMin Consensus = "replication_min"
+	// ConsensusAll requires all allocated peers to have pinned the content
+	ConsensusAll Consensus = "all"
+)
+
+// DefaultStatusPolicy is the default policy for evaluating a pin's status
+// across the cluster.
+var DefaultStatusPolicy = StatusPolicy{
+	Consensus:      ConsensusReplicationMin,
+	ReplicationMin: DefaultReplicationFactorMin,
+}
+
+// pendingStatuses lists, in order of precedence, the tracker statuses of peers
+// that have yet to pin the content.
+var pendingStatuses = []clusterapi.TrackerStatus{
+	clusterapi.TrackerStatusPinning,
+	clusterapi.TrackerStatusPinQueued,
+	clusterapi.TrackerStatusUndefined,
+}
+
+// ParseConsensus returns the Consensus for the given string. An empty string
+// is parsed as the default status policy's consensus.
+func ParseConsensus(s string) (Consensus, error) {
+	switch c := Consensus(strings.ToLower(s)); c {
+	case "":
+		return DefaultStatusPolicy.Consensus, nil
+	case ConsensusAny, ConsensusReplicationMin, ConsensusAll:
+		return c, nil
+	}
+	return "", fmt.Errorf("invalid status consensus ('%s')", s)
+}
+
+// StatusPolicy represents the policy for evaluating a pin's status over the
+// statuses reported by each cluster peer.
+type StatusPolicy struct {
+	Consensus      Consensus
+	ReplicationMin int // number of peers required by ConsensusReplicationMin
+}
+
+// TrackerStatus returns the tracker status of the given global pin status as
+// agreed upon by the cluster peers allocated to the pin. The pin is pinned once
+// the policy's required number of peers have pinned it; otherwise the status of
+// a pending peer, or else of a failed peer, is returned. Returns false if no
+// peer has reported a status.
+func (p StatusPolicy) TrackerStatus(
+	gblPinInfo clusterapi.GlobalPinInfo,
+) (clusterapi.TrackerStatus, bool) {
+	if len(gblPinInfo.PeerMap) == 0 {
+		return clusterapi.TrackerStatusUndefined, false
+	}
+	allocated := make(map[string]struct{})
+	for _, pid := range gblPinInfo.Allocations {
+		allocated[pid.String()] = struct{}{}
+	}
+	statuses := make(map[string]clusterapi.TrackerStatus)
+	for peer, pinInfo := range gblPinInfo.PeerMap {
+		// peers not allocated to the pin report it as remote; no
+		// allocations means the pin is allocated to every peer
+		if pinInfo.Status == clusterapi.TrackerStatusRemote {
+			continue
+		}
+		if _, ok := allocated[peer]; len(allocated) > 0 && !ok {
+			continue
+		}
+		statuses[peer] = pinInfo.Status
+	}
+	// allocated peers that have yet to report a status are pending
+	for peer := range allocated {
+		if _, ok := statuses[peer]; !ok {
+			statuses[peer] = clusterapi.TrackerStatusUndefined
+		}
+	}
+	if len(statuses) == 0 {
+		// no allocated peer is tracking the pin yet
+		return clusterapi.TrackerStatusUndefined, true
+	}
+	peers := make([]string, 0, len(statuses))
+	for peer := range statuses {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	required := 1
+	switch p.Consensus {
+	case ConsensusAll:
+		required = len(peers)
+	case ConsensusReplicationMin:
+		required = p.ReplicationMin
+		// a non-positive minimum replicates the pin everywhere; the
+		// minimum is capped by the number of allocated peers
+		if required <= 0 || required > len(peers) {
+			required = len(peers)
+		}
+	}
+	pinned := 0
+	found := make(map[clusterapi.TrackerStatus]struct{})
+	for _, peer := range peers {
+		ts := statuses[peer]
+		if ts == clusterapi.TrackerStatusPinned ||
+			ts == clusterapi.TrackerStatusSharded {
+			pinned++
+		}
+		found[ts] = struct{}{}
+	}
+	if pinned >= required {
+		return clusterapi.TrackerStatusPinned, true
+	}
+	for _, ts := range pendingStatuses {
+		if _, ok := found[ts]; ok {
+			return ts, true
+		}
+	}
+	// otherwise the status of the first peer that has not pinned the content
+	for _, peer := range peers {
+		ts := statuses[peer]
+		if ts != clusterapi.TrackerStatusPinned &&
+			ts != clusterapi.TrackerStatusSharded {
+			return ts, true
+		}
+	}
+	return clusterapi.TrackerStatusPinned, true
+}
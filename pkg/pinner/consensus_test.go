@@ -0,0 +1,112 @@
+package pinner
+
+import (
+	"testing"
+
+	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConsensus(t *testing.T) {
+	tests := map[string]Consensus{
+		"":                ConsensusReplicationMin,
+		"any":             ConsensusAny,
+		"replication_min": ConsensusReplicationMin,
+		"ALL":             ConsensusAll,
+	}
+	for s, expected := range tests {
+		actual, err := ParseConsensus(s)
+		require.Nil(t, err)
+		require.Equal(t, expected, actual)
+	}
+	_, err := ParseConsensus("most")
+	require.NotNil(t, err)
+}
+
+func TestStatusPolicyTrackerStatus(t *testing.T) {
+	peer1, peer2, peer3 := peer.ID("peer1"), peer.ID("peer2"), peer.ID("peer3")
+	gblPinInfo := func(
+		statuses ...clusterapi.TrackerStatus,
+	) clusterapi.GlobalPinInfo {
+		peers := []peer.ID{peer1, peer2, peer3}
+		peerMap := map[string]clusterapi.PinInfoShort{
+			// not allocated to the pin
+			"peer4": clusterapi.PinInfoShort{
+				Status: clusterapi.TrackerStatusRemote,
+			},
+		}
+		for i, ts := range statuses {
+			peerMap[peers[i].String()] = clusterapi.PinInfoShort{Status: ts}
+		}
+		return clusterapi.GlobalPinInfo{
+			Allocations: peers,
+			PeerMap:     peerMap,
+		}
+	}
+	anyPeer := StatusPolicy{Consensus: ConsensusAny}
+	replicationMin := StatusPolicy{
+		Consensus:      ConsensusReplicationMin,
+		ReplicationMin: 2,
+	}
+	all := StatusPolicy{Consensus: ConsensusAll}
+	tests := []struct {
+		Policy     StatusPolicy
+		GblPinInfo clusterapi.GlobalPinInfo
+		Expected   clusterapi.TrackerStatus
+	}{
+		{anyPeer, gblPinInfo(
+			clusterapi.TrackerStatusPinned,
+			clusterapi.TrackerStatusPinning,
+			clusterapi.TrackerStatusPinError,
+		), clusterapi.TrackerStatusPinned},
+		{replicationMin, gblPinInfo(
+			clusterapi.TrackerStatusPinned,
+			clusterapi.TrackerStatusPinning,
+			clusterapi.TrackerStatusPinError,
+		), clusterapi.TrackerStatusPinning},
+		{replicationMin, gblPinInfo(
+			clusterapi.TrackerStatusPinned,
+			clusterapi.TrackerStatusSharded,
+			clusterapi.TrackerStatusPinError,
+		), clusterapi.TrackerStatusPinned},
+		{all, gblPinInfo(
+			clusterapi.TrackerStatusPinned,
+			clusterapi.TrackerStatusPinned,
+			clusterapi.TrackerStatusPinQueued,
+		), clusterapi.TrackerStatusPinQueued},
+		{all, gblPinInfo(
+			clusterapi.TrackerStatusPinned,
+			clusterapi.TrackerStatusPinned,
+			clusterapi.TrackerStatusPinError,
+		), clusterapi.TrackerStatusPinError},
+		{all, gblPinInfo(
+			clusterapi.TrackerStatusPinned,
+			clusterapi.TrackerStatusPinned,
+			clusterapi.TrackerStatusPinned,
+		), clusterapi.TrackerStatusPinned},
+		// no allocated peer has reported a status
+		{anyPeer, gblPinInfo(), clusterapi.TrackerStatusUndefined},
+		// allocated peers that have yet to report are pending
+		{StatusPolicy{
+			Consensus:      ConsensusReplicationMin,
+			ReplicationMin: 3,
+		}, gblPinInfo(
+			clusterapi.TrackerStatusPinned,
+		), clusterapi.TrackerStatusUndefined},
+		{all, gblPinInfo(
+			clusterapi.TrackerStatusPinned,
+			clusterapi.TrackerStatusPinned,
+		), clusterapi.TrackerStatusUndefined},
+		{anyPeer, gblPinInfo(
+			clusterapi.TrackerStatusPinned,
+		), clusterapi.TrackerStatusPinned},
+	}
+	for i, test := range tests {
+		actual, ok := test.Policy.TrackerStatus(test.GblPinInfo)
+		require.True(t, ok, i)
+		require.Equal(t, test.Expected, actual, i)
+	}
+	_, ok := anyPeer.TrackerStatus(clusterapi.GlobalPinInfo{})
+	require.False(t, ok)
+}
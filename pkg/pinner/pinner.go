@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
 	cluster "github.com/ipfs-cluster/ipfs-cluster/api/rest/client"
@@ -27,12 +28,14 @@ var (
 
 type Pinner interface {
 	Add(pin models.Pin) error
+	Update(from string, pin models.Pin) error
 	Remove(cid string) error
 	Delegates() ([]string, error)
 
 	// Controls
 	SetReplicationFactor(min, max int) error
 	SetPinMode(mode clusterapi.PinMode)
+	SetRetries(retries int, backoff time.Duration) error
 }
 
 type pinner struct {
@@ -43,6 +46,8 @@ type pinner struct {
 	ReplicationFactorMin int
 	ReplicationFactorMax int
 	PinMode              clusterapi.PinMode // Recursive or direct pinning
+	Retries              int                // Retries of transient errors
+	RetryBackoff         time.Duration      // Initial delay between retries
 }
 
 func New(ctx context.Context, client cluster.Client) Pinner {
@@ -52,6 +57,8 @@ func New(ctx context.Context, client cluster.Client) Pinner {
 		ReplicationFactorMin: DefaultReplicationFactorMin,
 		ReplicationFactorMax: DefaultReplicationFactorMax,
 		PinMode:              DefaultPinMode,
+		Retries:              DefaultRetries,
+		RetryBackoff:         DefaultRetryBackoff,
 	}
 	return p
 }
@@ -61,26 +68,34 @@ func (p *pinner) Add(pin models.Pin) error {
 	if err != nil {
 		return err
 	}
-	origins := []clusterapi.Multiaddr{}
-	for _, s := range pin.Origins {
-		m, err := clusterapi.NewMultiaddr(s)
-		if err != nil {
-			return err
-		}
-		origins = append(origins, m)
+	opts, err := p.pinOptions(pin)
+	if err != nil {
+		return err
 	}
-	_, err = p.ipfsClient.Pin(p.ctx, clusterapi.NewCid(cid),
-		clusterapi.PinOptions{
-			ReplicationFactorMin: p.ReplicationFactorMin,
-			ReplicationFactorMax: p.ReplicationFactorMax,
-			Name:                 pin.Name,
-			Mode:                 p.PinMode,
-			ShardSize:            clusterapi.DefaultShardSize,
-			Metadata:             pin.Meta,
-			Origins:              origins,
-		},
-	)
-	return err
+	return p.pin(cid, opts)
+}
+
+// Update pins the given pin as a replacement of the pin with the "from" CID.
+// The cluster uses the existing pin as a reference to speed up pinning the new
+// CID; the existing pin is not removed.
+func (p *pinner) Update(from string, pin models.Pin) error {
+	if from == "" || from == pin.Cid {
+		return p.Add(pin)
+	}
+	prev, err := ipfscid.Decode(from)
+	if err != nil {
+		return err
+	}
+	cid, err := ipfscid.Decode(pin.Cid)
+	if err != nil {
+		return err
+	}
+	opts, err := p.pinOptions(pin)
+	if err != nil {
+		return err
+	}
+	opts.PinUpdate = clusterapi.NewCid(prev)
+	return p.pin(cid, opts)
 }
 
 func (p *pinner) Remove(cid string) error {
@@ -88,8 +103,10 @@ func (p *pinner) Remove(cid string) error {
 	if err != nil {
 		return err
 	}
-	_, err = p.ipfsClient.Unpin(p.ctx, clusterapi.NewCid(d))
-	return err
+	return p.retry(func() error {
+		_, err := p.ipfsClient.Unpin(p.ctx, clusterapi.NewCid(d))
+		return err
+	})
 }
 
 func (p *pinner) Delegates() ([]string, error) {
@@ -125,6 +142,48 @@ func (p *pinner) SetPinMode(mode clusterapi.PinMode) {
 	p.PinMode = mode
 }
 
+func (p *pinner) SetRetries(retries int, backoff time.Duration) error {
+	if retries < 0 {
+		return fmt.Errorf("Retries must not be negative")
+	}
+	if backoff <= 0 {
+		return fmt.Errorf("Retry backoff must be greater than zero")
+	}
+	p.Retries = retries
+	p.RetryBackoff = backoff
+	return nil
+}
+
+// pin pins the given CID to the cluster with the given options, retrying
+// transient errors.
+func (p *pinner) pin(cid ipfscid.Cid, opts clusterapi.PinOptions) error {
+	return p.retry(func() error {
+		_, err := p.ipfsClient.Pin(p.ctx, clusterapi.NewCid(cid), opts)
+		return err
+	})
+}
+
+// pinOptions returns the cluster's pinning options for the given pin.
+func (p *pinner) pinOptions(pin models.Pin) (clusterapi.PinOptions, error) {
+	origins := []clusterapi.Multiaddr{}
+	for _, s := range pin.Origins {
+		m, err := clusterapi.NewMultiaddr(s)
+		if err != nil {
+			return clusterapi.PinOptions{}, err
+		}
+		origins = append(origins, m)
+	}
+	return clusterapi.PinOptions{
+		ReplicationFactorMin: p.ReplicationFactorMin,
+		ReplicationFactorMax: p.ReplicationFactorMax,
+		Name:                 pin.Name,
+		Mode:                 p.PinMode,
+		ShardSize:            clusterapi.DefaultShardSize,
+		Metadata:             pin.Meta,
+		Origins:              origins,
+	}, nil
+}
+
 func ParseIPFromMultiaddr(addr ma.Multiaddr) (net.IP, error) {
 	s := addr.String()
 	parts := strings.Split(s, "/")
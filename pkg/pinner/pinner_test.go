@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
@@ -48,6 +49,123 @@ func TestPinnerAdd(t *testing.T) {
 	require.Nil(t, err)
 }
 
+func TestPinnerAddRetry(t *testing.T) {
+	ctx := context.Background()
+	pin := models.Pin{
+		Cid:  "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv",
+		Name: "helloworld",
+	}
+	cid, err := ipfscid.Decode(pin.Cid)
+	require.Nil(t, err)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockIpfsClient := mocks.NewMockClient(mockCtrl)
+	// a transient error is retried
+	gomock.InOrder(
+		mockIpfsClient.EXPECT().
+			Pin(ctx, clusterapi.NewCid(cid), gomock.Any()).
+			Return(clusterapi.Pin{}, clusterapi.Error{
+				Code:    0,
+				Message: "connection refused",
+			}),
+		mockIpfsClient.EXPECT().
+			Pin(ctx, clusterapi.NewCid(cid), gomock.Any()).
+			Return(clusterapi.Pin{}, nil),
+	)
+	p := &pinner{
+		ctx:          ctx,
+		ipfsClient:   mockIpfsClient,
+		PinMode:      DefaultPinMode,
+		Retries:      DefaultRetries,
+		RetryBackoff: time.Millisecond,
+	}
+	err = p.Add(pin)
+	require.Nil(t, err)
+
+	// a non-transient error is not retried
+	mockIpfsClient.EXPECT().
+		Pin(ctx, clusterapi.NewCid(cid), gomock.Any()).
+		Return(clusterapi.Pin{}, clusterapi.Error{
+			Code:    400,
+			Message: "bad request",
+		})
+	err = p.Add(pin)
+	require.NotNil(t, err)
+
+	// retries are exhausted
+	mockIpfsClient.EXPECT().
+		Pin(ctx, clusterapi.NewCid(cid), gomock.Any()).
+		Return(clusterapi.Pin{}, clusterapi.Error{
+			Code:    503,
+			Message: "service unavailable",
+		}).
+		Times(DefaultRetries + 1)
+	err = p.Add(pin)
+	require.NotNil(t, err)
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		Err      error
+		Expected bool
+	}{
+		{clusterapi.Error{Code: 0}, true},
+		{clusterapi.Error{Code: 429}, true},
+		{clusterapi.Error{Code: 500}, true},
+		{clusterapi.Error{Code: 400}, false},
+		{clusterapi.Error{Code: 404}, false},
+		{fmt.Errorf("invalid cid"), false},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.Expected, IsTransient(test.Err))
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	require.True(t, IsNotFound(clusterapi.Error{Code: 404}))
+	require.True(t, IsNotFound(
+		fmt.Errorf("unpin: %w", clusterapi.Error{Code: 404})))
+	require.False(t, IsNotFound(clusterapi.Error{Code: 500}))
+	require.False(t, IsNotFound(fmt.Errorf("not found")))
+}
+
+func TestPinnerUpdate(t *testing.T) {
+	ctx := context.Background()
+	from := "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv"
+	pin := models.Pin{
+		Cid:  "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+		Name: "helloworld",
+		Meta: models.Info{"uid": "myuserid"},
+	}
+	prev, err := ipfscid.Decode(from)
+	require.Nil(t, err)
+	cid, err := ipfscid.Decode(pin.Cid)
+	require.Nil(t, err)
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockIpfsClient := mocks.NewMockClient(mockCtrl)
+	mockIpfsClient.EXPECT().
+		Pin(ctx, clusterapi.NewCid(cid), clusterapi.PinOptions{
+			ReplicationFactorMin: DefaultReplicationFactorMin,
+			ReplicationFactorMax: DefaultReplicationFactorMax,
+			Name:                 pin.Name,
+			Mode:                 DefaultPinMode,
+			ShardSize:            clusterapi.DefaultShardSize,
+			Metadata:             pin.Meta,
+			PinUpdate:            clusterapi.NewCid(prev),
+			Origins:              []clusterapi.Multiaddr{},
+		})
+	p := &pinner{
+		ctx:                  ctx,
+		ipfsClient:           mockIpfsClient,
+		ReplicationFactorMin: DefaultReplicationFactorMin,
+		ReplicationFactorMax: DefaultReplicationFactorMax,
+		PinMode:              DefaultPinMode,
+	}
+	err = p.Update(from, pin)
+	require.Nil(t, err)
+}
+
 func TestPinnerRemove(t *testing.T) {
 	ctx := context.Background()
 	cidStr := "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv"
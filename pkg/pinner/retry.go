@@ -0,0 +1,56 @@
+package pinner
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
+)
+
+const (
+	DefaultRetries      = 3
+	DefaultRetryBackoff = time.Second
+)
+
+// IsTransient returns true if the given error is a transient IPFS cluster
+// error; I.e. the cluster could not be reached, is throttling requests, or
+// failed with a server error. Such requests are worth retrying.
+func IsTransient(err error) bool {
+	var apiErr clusterapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	// The cluster client reports connection failures with a zero code
+	return apiErr.Code == 0 ||
+		apiErr.Code == http.StatusTooManyRequests ||
+		apiErr.Code >= http.StatusInternalServerError
+}
+
+// IsNotFound returns true if the given error is an IPFS cluster not found
+// error; I.e. the cluster is not tracking the CID, such as when unpinning a CID
+// that failed to be pinned or was unpinned from the cluster directly.
+func IsNotFound(err error) bool {
+	var apiErr clusterapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// retry calls the given function until it succeeds, fails with a
+// non-transient error, or the pinner's retries are exhausted. The delay
+// between attempts starts at the pinner's retry backoff and doubles after each
+// attempt.
+func (p *pinner) retry(fn func() error) error {
+	backoff := p.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !IsTransient(err) || attempt >= p.Retries {
+			return err
+		}
+		select {
+		case <-p.ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,50 @@
+package pinner
+
+import (
+	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+const (
+	// InfoClusterStatus is the PinStatus info key holding the raw status
+	// reported by the IPFS cluster
+	InfoClusterStatus = "cluster_status"
+
+	// InfoStatusDetails is the PinStatus info key holding the details of a
+	// pin's status, such as the reason a pin failed
+	InfoStatusDetails = "status_details"
+)
+
+// trackerStatuses maps the IPFS cluster's tracker statuses onto the statuses
+// defined by the pinning service API (queued, pinning, pinned, and failed).
+var trackerStatuses = map[clusterapi.TrackerStatus]models.Status{
+	// Not yet known to the cluster
+	clusterapi.TrackerStatusUndefined: models.StatusQueued,
+	// Errors
+	clusterapi.TrackerStatusClusterError:         models.StatusFailed,
+	clusterapi.TrackerStatusPinError:             models.StatusFailed,
+	clusterapi.TrackerStatusUnpinError:           models.StatusFailed,
+	clusterapi.TrackerStatusUnexpectedlyUnpinned: models.StatusFailed,
+	// Pinning
+	clusterapi.TrackerStatusPinQueued: models.StatusQueued,
+	clusterapi.TrackerStatusPinning:   models.StatusPinning,
+	clusterapi.TrackerStatusPinned:    models.StatusPinned,
+	clusterapi.TrackerStatusSharded:   models.StatusPinned,
+	// The pin is allocated to, and tracked by, other cluster peers
+	clusterapi.TrackerStatusRemote: models.StatusPinned,
+	// Unpinning; the content is not, or will no longer be, pinned
+	clusterapi.TrackerStatusUnpinQueued: models.StatusFailed,
+	clusterapi.TrackerStatusUnpinning:   models.StatusFailed,
+	clusterapi.TrackerStatusUnpinned:    models.StatusFailed,
+}
+
+// StatusFromTracker returns the pinning service API status for the given IPFS
+// cluster tracker status. Composite or unknown tracker statuses are reported
+// as failed.
+func StatusFromTracker(ts clusterapi.TrackerStatus) models.Status {
+	if s, ok := trackerStatuses[ts]; ok {
+		return s
+	}
+	return models.StatusFailed
+}
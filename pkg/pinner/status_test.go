@@ -0,0 +1,42 @@
+package pinner
+
+import (
+	"testing"
+
+	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+func TestStatusFromTracker(t *testing.T) {
+	tests := map[clusterapi.TrackerStatus]models.Status{
+		clusterapi.TrackerStatusUndefined:            models.StatusQueued,
+		clusterapi.TrackerStatusClusterError:         models.StatusFailed,
+		clusterapi.TrackerStatusPinError:             models.StatusFailed,
+		clusterapi.TrackerStatusUnpinError:           models.StatusFailed,
+		clusterapi.TrackerStatusError:                models.StatusFailed,
+		clusterapi.TrackerStatusPinned:               models.StatusPinned,
+		clusterapi.TrackerStatusPinning:              models.StatusPinning,
+		clusterapi.TrackerStatusUnpinning:            models.StatusFailed,
+		clusterapi.TrackerStatusUnpinned:             models.StatusFailed,
+		clusterapi.TrackerStatusRemote:               models.StatusPinned,
+		clusterapi.TrackerStatusPinQueued:            models.StatusQueued,
+		clusterapi.TrackerStatusUnpinQueued:          models.StatusFailed,
+		clusterapi.TrackerStatusQueued:               models.StatusFailed,
+		clusterapi.TrackerStatusSharded:              models.StatusPinned,
+		clusterapi.TrackerStatusUnexpectedlyUnpinned: models.StatusFailed,
+	}
+	spec := map[models.Status]struct{}{
+		models.StatusQueued:  {},
+		models.StatusPinning: {},
+		models.StatusPinned:  {},
+		models.StatusFailed:  {},
+	}
+	for ts, expected := range tests {
+		actual := StatusFromTracker(ts)
+		require.Equal(t, expected, actual, ts.String())
+		_, ok := spec[actual]
+		require.True(t, ok, ts.String())
+	}
+}
@@ -2,15 +2,16 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
+	"io"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/crossedbot/common/golang/config"
-	middleware "github.com/crossedbot/simplemiddleware"
+	"github.com/crossedbot/common/golang/logger"
 	"github.com/google/uuid"
 	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
 	cluster "github.com/ipfs-cluster/ipfs-cluster/api/rest/client"
@@ -22,16 +23,43 @@ import (
 	pinsdb "github.com/crossedbot/axis/pkg/pins/database"
 	"github.com/crossedbot/axis/pkg/pins/models"
 	"github.com/crossedbot/axis/pkg/pinwatcher"
+	"github.com/crossedbot/axis/pkg/reconciler"
+)
+
+const (
+	// exportPageSize is the number of pins retrieved per query when
+	// exporting the pins database
+	exportPageSize = 1000
+
+	// apiKeyPrefixLen is the number of random characters of an API key
+	// kept, following its prefix, to identify the key
+	apiKeyPrefixLen = 6
+
+	// InfoReplaces is the PinStatus info key holding the ID of the pin
+	// replaced by the pin, removed once the pin is pinned
+	InfoReplaces = "replaces"
 )
 
 var (
 	// Pins controller errors
-	ErrorPinNotFound = errors.New("pin not found")
+	ErrorPinNotFound      = errors.New("pin not found")
+	ErrorInvalidPinRecord = errors.New("invalid pin record")
+	ErrorPinExists        = errors.New("pin already exists")
+	ErrorInvalidTimestamp = errors.New("invalid timestamp")
+	ErrorMaxNameLimit     = fmt.Errorf(
+		"max name limit exceeded %d characters", MaxNameLimit)
+	ErrorQuotaExceeded   = errors.New("pin quota exceeded")
+	ErrorApiKeyNotFound  = errors.New("API key not found")
+	ErrorApiKeyForbidden = errors.New("API keys cannot be issued by API keys")
+	ErrorInvalidUser     = errors.New("invalid user identifier")
+	ErrorNoCluster       = errors.New("no IPFS cluster to pin to")
 )
 
 // Controller represents an interface to the Pins manager
 type Controller interface {
-	// FindPins returns all pins that match the given parameters
+	// FindPins returns all pins that match the given parameters. If cursor
+	// is set, only the pins following it are returned. When sorted by
+	// creation, the cursor of the next page is returned if more pins match.
 	FindPins(
 		uid string,
 		cids []string,
@@ -39,6 +67,7 @@ type Controller interface {
 		match models.TextMatch,
 		statuses []models.Status,
 		limit int, offset int,
+		cursor string,
 		sortBy string, meta models.Info,
 	) (models.Pins, error)
 	// GetPin returns the Pin for the given ID
@@ -51,18 +80,57 @@ type Controller interface {
 	PatchPin(uid, id string, data models.Pin) (models.PinStatus, error)
 	// RemovePin deletes the Pin at the given ID
 	RemovePin(uid, id string) error
+	// GetReconciliation returns the summary of the last reconciliation
+	// between the Pins database and the IPFS cluster; it covers the Pins
+	// of all users
+	GetReconciliation() (models.Reconciliation, error)
+	// ExportPins writes the Pins, of all users, that match the given
+	// parameters to w as newline delimited JSON records. If the export
+	// fails after writing records, it ends with a record of the error.
+	// Returns the number of Pins written.
+	ExportPins(
+		w io.Writer,
+		cids []string,
+		name, before, after string,
+		match models.TextMatch,
+		statuses []models.Status,
+		meta models.Info,
+	) (int, error)
+	// ImportPins creates the Pins of the newline delimited JSON records
+	// read from r. Existing Pins are only replaced if overwrite is set. If
+	// repin is set, the Pins' CIDs are pinned to the IPFS cluster. Returns
+	// the number of Pins imported.
+	ImportPins(r io.Reader, repin, overwrite bool) (int, error)
+	// CreateApiKey issues a new API key, of the given name, to the user.
+	// The key acts with the given grant; it is only returned once.
+	CreateApiKey(uid, grant string, scopes []string, name string) (models.ApiKey, error)
+	// FindApiKeys returns the API keys of the user
+	FindApiKeys(uid string) (models.ApiKeys, error)
+	// RevokeApiKey deletes the API key at the given ID
+	RevokeApiKey(uid, id string) error
+	// AuthenticateApiKey returns the API key matching the given key
+	AuthenticateApiKey(key string) (models.ApiKey, error)
 }
 
 // controller implements the Controller interface
 type controller struct {
-	ctx     context.Context
-	client  cluster.Client
-	db      pinsdb.Pins
-	pinner  pinner.Pinner
-	watcher pinwatcher.PinWatcher
+	ctx        context.Context
+	client     cluster.Client
+	db         pinsdb.Pins
+	pinner     pinner.Pinner
+	watcher    pinwatcher.PinWatcher
+	policy     pinner.StatusPolicy
+	reconciler reconciler.Reconciler
+
+	// strictTimestamps rejects Unix timestamps in place of RFC 3339
+	// timestamps
+	strictTimestamps bool
+	// maxPins is the number of pins a user may create; unlimited if 0
+	maxPins int
 }
 
 type Config struct {
+	DatabaseDriver       string   `toml:"database_driver"` // redis, memory, postgres, or bolt
 	DatabaseAddr         string   `toml:"database_addr"`
 	AuthenticatorAddr    string   `toml:"authenticator_addr"`
 	AuthenticationGrants []string `toml:"authentication_grants"`
@@ -74,6 +142,39 @@ type Config struct {
 	IpfsClusterApiAddr      string `toml:"ipfs_cluster_api_addr"`
 	IpfsClusterProtectorKey []byte `toml:"ipfs_cluster_protector_key"`
 	IpfsClusterTimeout      int    `toml:"ipfs_cluster_timeout"` // in seconds
+
+	// Pin watcher configuration
+	PinWatcherCheckFrequency int `toml:"pin_watcher_check_frequency"` // in seconds
+	PinWatcherWorkers        int `toml:"pin_watcher_workers"`
+
+	// Pinner configuration
+	PinnerRetries        int    `toml:"pinner_retries"`
+	PinnerRetryBackoff   int    `toml:"pinner_retry_backoff"` // in milliseconds
+	ReplicationFactorMin int    `toml:"replication_factor_min"`
+	ReplicationFactorMax int    `toml:"replication_factor_max"`
+	StatusConsensus      string `toml:"status_consensus"` // any, replication_min, or all
+
+	// Reconciler configuration
+	ReconcileFrequency int `toml:"reconcile_frequency"` // in seconds
+
+	// StrictTimestamps rejects the Unix timestamps, in seconds, accepted
+	// for compatibility with existing clients
+	StrictTimestamps bool `toml:"strict_timestamps"`
+
+	// MaxPinsPerUser is the number of pins a user may create; unlimited if
+	// unset
+	MaxPinsPerUser int `toml:"max_pins_per_user"`
+
+	// AuthenticatorIssuer is the OpenID Connect issuer of tokens, whose
+	// JWKS document is discovered in place of the authenticator address;
+	// it requires the audience of tokens to be set
+	AuthenticatorIssuer   string `toml:"authenticator_issuer"`
+	AuthenticatorAudience string `toml:"authenticator_audience"`
+	AuthenticatorSkew     int    `toml:"authenticator_clock_skew"` // in seconds
+
+	// AuthenticationRequireScopes rejects tokens without scopes; otherwise
+	// such tokens may access every route but the admin routes
+	AuthenticationRequireScopes bool `toml:"authentication_require_scopes"`
 }
 
 // control is a singleton of a Controller and can be accessed via the Ctrl
@@ -97,11 +198,14 @@ var Ctrl = func() Controller {
 			}
 		}
 		ctx := context.Background()
-		db, err := pinsdb.New(ctx, cfg.DatabaseAddr, cfg.DropDatabaseOnStart)
+		db, err := pinsdb.Open(
+			ctx, cfg.DatabaseDriver, cfg.DatabaseAddr,
+			cfg.DropDatabaseOnStart,
+		)
 		if err != nil {
 			panic(fmt.Errorf(
-				"Controller: failed to connect to database at address ('%s') with error: %s",
-				cfg.DatabaseAddr, err,
+				"Controller: failed to open database ('%s') at address ('%s') with error: %s",
+				cfg.DatabaseDriver, cfg.DatabaseAddr, err,
 			))
 		}
 		apiAddr, err := ma.NewMultiaddr(cfg.IpfsClusterApiAddr)
@@ -124,23 +228,117 @@ var Ctrl = func() Controller {
 				cfg.IpfsClusterApiAddr, err,
 			))
 		}
-		middleware.SetKeyFunc(auth.KeyFunc(cfg.AuthenticatorAddr))
-		middleware.SetErrFunc(auth.ErrFunc())
-		control = New(ctx, ipfsClient, db)
+		if cfg.AuthenticatorIssuer != "" {
+			auth.SetKeyFunc(auth.OidcKeyFunc(cfg.AuthenticatorIssuer))
+		} else {
+			auth.SetKeyFunc(auth.JwksKeyFunc(cfg.AuthenticatorAddr))
+		}
+		auth.SetRequireScopes(cfg.AuthenticationRequireScopes)
+		claimsPolicy := auth.ClaimsPolicy{
+			Issuer:    cfg.AuthenticatorIssuer,
+			Audience:  cfg.AuthenticatorAudience,
+			ClockSkew: time.Duration(cfg.AuthenticatorSkew) * time.Second,
+		}
+		if err := claimsPolicy.Check(); err != nil {
+			panic(fmt.Errorf(
+				"Controller: invalid authenticator configuration: %s",
+				err,
+			))
+		}
+		auth.SetClaimsPolicy(claimsPolicy)
+		consensus, err := pinner.ParseConsensus(cfg.StatusConsensus)
+		if err != nil {
+			panic(fmt.Errorf(
+				"Controller: failed to parse status consensus with error: %s",
+				err,
+			))
+		}
+		policy := pinner.StatusPolicy{
+			Consensus:      consensus,
+			ReplicationMin: pinner.DefaultReplicationFactorMin,
+		}
+		if cfg.ReplicationFactorMin > 0 {
+			policy.ReplicationMin = cfg.ReplicationFactorMin
+		}
+		watcher := pinwatcher.New(
+			ctx, ipfsClient, db,
+			time.Duration(cfg.PinWatcherCheckFrequency)*time.Second,
+			cfg.PinWatcherWorkers, policy,
+		)
+		c := New(ctx, ipfsClient, db, watcher, policy).(*controller)
+		if cfg.ReplicationFactorMin > 0 {
+			max := cfg.ReplicationFactorMax
+			if max == 0 {
+				max = pinner.DefaultReplicationFactorMax
+			}
+			err := c.pinner.SetReplicationFactor(
+				cfg.ReplicationFactorMin, max)
+			if err != nil {
+				panic(fmt.Errorf(
+					"Controller: failed to set replication factor with error: %s",
+					err,
+				))
+			}
+		}
+		if cfg.PinnerRetryBackoff > 0 {
+			err := c.pinner.SetRetries(
+				cfg.PinnerRetries,
+				time.Duration(cfg.PinnerRetryBackoff)*time.Millisecond,
+			)
+			if err != nil {
+				panic(fmt.Errorf(
+					"Controller: failed to set pinner retries with error: %s",
+					err,
+				))
+			}
+		}
+		auth.SetApiKeyFunc(func(key string) (string, string, []string, error) {
+			apiKey, err := c.AuthenticateApiKey(key)
+			return apiKey.Owner, apiKey.Grant, apiKey.Scopes, err
+		})
+		c.strictTimestamps = cfg.StrictTimestamps
+		c.maxPins = cfg.MaxPinsPerUser
+		go c.reconciler.Run(
+			time.Duration(cfg.ReconcileFrequency) * time.Second)
+		control = c
 	})
 	return control
 }
 
-// New returns a new Controller for the given context and Pins database
-// interface
-func New(ctx context.Context, client cluster.Client, db pinsdb.Pins) Controller {
-	return &controller{
-		ctx:     ctx,
-		client:  client,
-		db:      db,
-		pinner:  pinner.New(ctx, client),
-		watcher: pinwatcher.New(ctx, client, db),
+// NewOffline returns a new Controller for the given context and Pins database
+// interface only; it neither connects to an IPFS cluster nor watches pins, and
+// so is limited to exporting pins, and importing pins without repinning them.
+func NewOffline(ctx context.Context, db pinsdb.Pins) Controller {
+	return &controller{ctx: ctx, db: db}
+}
+
+// New returns a new Controller for the given context, IPFS cluster client,
+// Pins database interface, pin watcher, and status policy
+func New(
+	ctx context.Context,
+	client cluster.Client,
+	db pinsdb.Pins,
+	watcher pinwatcher.PinWatcher,
+	policy pinner.StatusPolicy,
+) Controller {
+	p := pinner.New(ctx, client)
+	c := &controller{
+		ctx:        ctx,
+		client:     client,
+		db:         db,
+		pinner:     p,
+		watcher:    watcher,
+		policy:     policy,
+		reconciler: reconciler.New(ctx, client, db, p, watcher, policy),
+	}
+	// resume tracking pins that were pending when the service stopped
+	if err := c.watcher.Restore(c.retireReplaced); err != nil {
+		logger.Error(fmt.Sprintf(
+			"Controller: failed to restore pin watcher: %s",
+			err,
+		))
 	}
+	return c
 }
 
 func (c *controller) FindPins(
@@ -150,28 +348,24 @@ func (c *controller) FindPins(
 	match models.TextMatch,
 	statuses []models.Status,
 	limit int, offset int,
+	cursor string,
 	sortBy string, meta models.Info,
 ) (models.Pins, error) {
-	var err error
-	ss := []string{}
-	for _, s := range statuses {
-		ss = append(ss, s.String())
+	if err := checkUser(uid); err != nil {
+		return models.Pins{}, err
 	}
-	b := int64(0)
-	if before != "" {
-		b, err = strconv.ParseInt(before, 10, 64)
-		if err != nil {
-			return models.Pins{}, fmt.Errorf(
-				"'before' (%s) is not an integer", before)
-		}
+	ss, b, a, err := findParams(
+		statuses, before, after, !c.strictTimestamps)
+	if err != nil {
+		return models.Pins{}, err
 	}
-	a := int64(0)
-	if after != "" {
-		a, err = strconv.ParseInt(after, 10, 64)
+	var from *pinsdb.Cursor
+	if cursor != "" {
+		cur, err := pinsdb.ParseCursor(cursor)
 		if err != nil {
-			return models.Pins{}, fmt.Errorf(
-				"'after' (%s) is not an integer", after)
+			return models.Pins{}, err
 		}
+		from = &cur
 	}
 	sorting := &pinsdb.SortingKey{Field: "created", Ascending: true}
 	if sortBy != "" {
@@ -182,30 +376,57 @@ func (c *controller) FindPins(
 			sorting.Field = sortBy
 		}
 	}
-	// retrieve pins from datastore
-	return c.db.Find(cids, ss, name, b, a, match.String(), limit, offset,
-		sorting, meta)
+	// retrieve the user's pins from datastore
+	pins, err := c.db.Find(uid, cids, ss, name, b, a, match.String(), limit,
+		offset, from, sorting, meta)
+	if err != nil {
+		return models.Pins{}, err
+	}
+	if sorting.Field == "created" && pins.Count > 0 &&
+		offset+pins.Count < pins.Total {
+		next, err := pinsdb.NewCursor(pins.Results[pins.Count-1])
+		if err != nil {
+			return models.Pins{}, err
+		}
+		pins.Next = next.String()
+	}
+	return pins, nil
 }
 
 func (c *controller) GetPin(uid, id string) (models.PinStatus, error) {
-	c.UpdatePinStatus(uid, id)
-	// retrieve pin from datastore
-	ps, err := c.db.Get(id)
-	if err == pinsdb.ErrNotFound {
-		return models.PinStatus{}, ErrorPinNotFound
+	if err := c.UpdatePinStatus(uid, id); err == ErrorPinNotFound {
+		return models.PinStatus{}, err
 	}
-	return ps, err
+	// retrieve pin from datastore
+	return c.getPin(uid, id)
 }
 
 func (c *controller) CreatePin(uid string, pin models.Pin) (models.PinStatus, error) {
+	if err := checkUser(uid); err != nil {
+		return models.PinStatus{}, err
+	}
+	if len(pin.Name) > MaxNameLimit {
+		return models.PinStatus{}, ErrorMaxNameLimit
+	}
+	if c.maxPins > 0 {
+		pins, err := c.db.Find(
+			uid, nil, nil, "", 0, 0, "", 1, 0, nil, nil, nil)
+		if err != nil {
+			return models.PinStatus{}, err
+		}
+		if pins.Total >= c.maxPins {
+			return models.PinStatus{}, ErrorQuotaExceeded
+		}
+	}
 	// Add pin status to datastore
 	delegates, _ := c.pinner.Delegates()
 	ps := models.PinStatus{
 		Id:        uuid.New().String(),
-		Status:    models.StatusInit.String(),
-		Created:   strconv.FormatInt(time.Now().Unix(), 10),
+		Status:    models.StatusQueued.String(),
+		Created:   models.FormatTime(time.Now()),
 		Pin:       pin,
 		Delegates: delegates,
+		Owner:     uid,
 	}
 	err := c.db.Set(ps)
 	if err != nil {
@@ -217,26 +438,64 @@ func (c *controller) CreatePin(uid string, pin models.Pin) (models.PinStatus, er
 	}
 	go func() {
 		c.watcher.Register(
-			ps, clusterapi.TrackerStatusPinned, 1*time.Minute)
-		c.pinner.Add(pin)
-		c.watcher.Deregister(ps.Id)
+			ps, clusterapi.TrackerStatusPinned, nil)
+		if err := c.pinner.Add(pin); err != nil {
+			c.fail(ps, err)
+		}
 	}()
 	return ps, nil
 }
 
+// UpdatePin replaces the Pin at the given ID. Per the pinning service API, a
+// replacement is a new pin request; the new pin is created under a new ID and
+// the previous pin is removed once the new one is pinned. The previous pin's ID
+// is kept in the new pin's info, so that it is removed even if the service
+// restarts in the meantime.
 func (c *controller) UpdatePin(uid, id string, pin models.Pin) (models.PinStatus, error) {
-	fields := map[string]interface{}{
-		"name":    pin.Name,
-		"origins": pin.Origins,
-		"meta":    pin.Meta,
+	if len(pin.Name) > MaxNameLimit {
+		return models.PinStatus{}, ErrorMaxNameLimit
 	}
-	if err := c.db.Patch(id, fields); err != nil {
+	prev, err := c.getPin(uid, id)
+	if err != nil {
 		return models.PinStatus{}, err
 	}
-	return c.db.Get(id)
+	if pin.Cid == "" {
+		pin.Cid = prev.Pin.Cid
+	}
+	delegates, _ := c.pinner.Delegates()
+	ps := models.PinStatus{
+		Id:        uuid.New().String(),
+		Status:    models.StatusQueued.String(),
+		Created:   models.FormatTime(time.Now()),
+		Pin:       pin,
+		Delegates: delegates,
+		Info:      models.Info{InfoReplaces: prev.Id},
+		Owner:     uid,
+	}
+	if err := c.db.Set(ps); err != nil {
+		return models.PinStatus{}, err
+	}
+	ps, err = c.db.Get(ps.Id)
+	if err != nil {
+		return models.PinStatus{}, err
+	}
+	go func() {
+		c.watcher.Register(
+			ps, clusterapi.TrackerStatusPinned, c.retireReplaced)
+		if err := c.pinner.Update(prev.Pin.Cid, ps.Pin); err != nil {
+			c.fail(ps, err)
+		}
+	}()
+	return ps, nil
 }
 
 func (c *controller) PatchPin(uid, id string, pin models.Pin) (models.PinStatus, error) {
+	if len(pin.Name) > MaxNameLimit {
+		return models.PinStatus{}, ErrorMaxNameLimit
+	}
+	if _, err := c.getPin(uid, id); err != nil {
+		return models.PinStatus{}, err
+	}
 	fields := make(map[string]interface{})
 	if pin.Name != "" {
 		fields["name"] = pin.Name
@@ -254,39 +513,361 @@ func (c *controller) PatchPin(uid, id string, pin models.Pin) (models.PinStatus,
 }
 
 func (c *controller) RemovePin(uid, id string) error {
-	ps, err := c.db.Get(id)
+	ps, err := c.getPin(uid, id)
 	if err != nil {
 		return err
 	}
-	c.pinner.Remove(ps.Pin.Cid)
-	if err := c.db.Delete(id); err != nil {
+	return c.remove(ps)
+}
+
+func (c *controller) GetReconciliation() (models.Reconciliation, error) {
+	return c.reconciler.Last(), nil
+}
+
+func (c *controller) ExportPins(
+	w io.Writer,
+	cids []string,
+	name, before, after string,
+	match models.TextMatch,
+	statuses []models.Status,
+	meta models.Info,
+) (int, error) {
+	ss, b, a, err := findParams(
+		statuses, before, after, !c.strictTimestamps)
+	if err != nil {
+		return 0, err
+	}
+	enc := json.NewEncoder(w)
+	n, err := c.exportPins(enc, cids, ss, name, b, a, match, meta)
+	if err != nil && n > 0 {
+		// mark the export as incomplete
+		enc.Encode(models.NewFailure(models.ErrProcessingRequestCode,
+			fmt.Sprintf("export failed after %d record(s); %s", n, err)))
+	}
+	return n, err
+}
+
+// exportPins encodes the Pins, of all users, that match the given parameters
+// as PinRecords, page by page. Returns the number of Pins encoded.
+func (c *controller) exportPins(
+	enc *json.Encoder,
+	cids, statuses []string,
+	name string,
+	before, after int64,
+	match models.TextMatch,
+	meta models.Info,
+) (int, error) {
+	sorting := &pinsdb.SortingKey{Field: "created", Ascending: true}
+	n := 0
+	var cursor *pinsdb.Cursor
+	for {
+		pins, err := c.db.Find(pinsdb.AllOwners, cids, statuses, name,
+			before, after, match.String(), exportPageSize, 0, cursor,
+			sorting, meta)
+		if err != nil {
+			return n, err
+		}
+		for _, ps := range pins.Results {
+			if err := enc.Encode(models.NewPinRecord(ps)); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(pins.Results) < exportPageSize {
+			return n, nil
+		}
+		next, err := pinsdb.NewCursor(pins.Results[len(pins.Results)-1])
+		if err != nil {
+			return n, err
+		}
+		cursor = &next
+	}
+}
+
+func (c *controller) ImportPins(r io.Reader, repin, overwrite bool) (int, error) {
+	if repin && c.pinner == nil {
+		return 0, ErrorNoCluster
+	}
+	dec := json.NewDecoder(r)
+	n := 0
+	for {
+		var rec models.PinRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("%w (record %d): %s",
+				ErrorInvalidPinRecord, n+1, err)
+		}
+		if rec.Error != nil {
+			return n, fmt.Errorf("%w (record %d): incomplete export; %s",
+				ErrorInvalidPinRecord, n+1, rec.Error.Details)
+		}
+		ps := rec.ToPinStatus()
+		if ps.Id == "" {
+			return n, fmt.Errorf("%w (record %d): missing request ID",
+				ErrorInvalidPinRecord, n+1)
+		}
+		if err := checkUser(ps.Owner); err != nil {
+			return n, fmt.Errorf("%w (record %d): invalid owner ('%s')",
+				ErrorInvalidPinRecord, n+1, ps.Owner)
+		}
+		if _, err := ipfscid.Decode(ps.Pin.Cid); err != nil {
+			return n, fmt.Errorf("%w (record %d): %s",
+				ErrorInvalidPinRecord, n+1, err)
+		}
+		// records exported prior to RFC 3339 timestamps are accepted
+		created, err := models.ParseTime(ps.Created, true)
+		if err != nil {
+			return n, fmt.Errorf("%w (record %d): %s",
+				ErrorInvalidPinRecord, n+1, err)
+		}
+		ps.Created = models.FormatTime(created)
+		if !overwrite {
+			_, err := c.db.Get(ps.Id)
+			if err == nil {
+				return n, fmt.Errorf("%w (record %d): %s",
+					ErrorPinExists, n+1, ps.Id)
+			} else if err != pinsdb.ErrNotFound {
+				return n, err
+			}
+		}
+		if repin {
+			// the status is tracked anew on the target cluster
+			ps.Status = models.StatusQueued.String()
+			ps.Delegates, _ = c.pinner.Delegates()
+			ps.Info = models.Info{}
+		}
+		if err := c.db.Set(ps); err != nil {
+			return n, err
+		}
+		if repin {
+			c.watcher.Register(ps, clusterapi.TrackerStatusPinned, nil)
+			if err := c.pinner.Add(ps.Pin); err != nil {
+				c.fail(ps, err)
+			}
+		}
+		n++
+	}
+}
+
+func (c *controller) CreateApiKey(uid, grant string, scopes []string, name string) (models.ApiKey, error) {
+	if err := checkUser(uid); err != nil {
+		return models.ApiKey{}, err
+	}
+	if len(name) > MaxNameLimit {
+		return models.ApiKey{}, ErrorMaxNameLimit
+	}
+	key, err := auth.NewApiKey()
+	if err != nil {
+		return models.ApiKey{}, err
+	}
+	apiKey := models.ApiKey{
+		Id:      uuid.New().String(),
+		Name:    name,
+		Prefix:  key[:len(auth.ApiKeyPrefix)+apiKeyPrefixLen],
+		Created: models.FormatTime(time.Now()),
+		Hash:    auth.HashApiKey(key),
+		Owner:   uid,
+		Grant:   grant,
+		Scopes:  scopes,
+	}
+	if err := c.db.SetApiKey(apiKey); err != nil {
+		return models.ApiKey{}, err
+	}
+	apiKey.Key = key
+	return apiKey, nil
+}
+
+func (c *controller) FindApiKeys(uid string) (models.ApiKeys, error) {
+	if err := checkUser(uid); err != nil {
+		return models.ApiKeys{}, err
+	}
+	keys, err := c.db.FindApiKeys(uid)
+	if err != nil {
+		return models.ApiKeys{}, err
+	}
+	return models.ApiKeys{Count: len(keys), Results: keys}, nil
+}
+
+func (c *controller) RevokeApiKey(uid, id string) error {
+	if err := checkUser(uid); err != nil {
 		return err
 	}
-	return nil
+	err := c.db.DeleteApiKey(uid, id)
+	if err == pinsdb.ErrApiKeyNotFound {
+		return ErrorApiKeyNotFound
+	}
+	return err
+}
+
+func (c *controller) AuthenticateApiKey(key string) (models.ApiKey, error) {
+	apiKey, err := c.db.GetApiKey(auth.HashApiKey(key))
+	if err == pinsdb.ErrApiKeyNotFound {
+		return models.ApiKey{}, ErrorApiKeyNotFound
+	}
+	return apiKey, err
 }
 
 func (c *controller) UpdatePinStatus(uid, id string) error {
-	ps, err := c.db.Get(id)
+	ps, err := c.getPin(uid, id)
 	if err != nil {
 		return err
 	}
-	prevStatus := ps.Status
-	currStatus := prevStatus
 	cid, err := ipfscid.Decode(ps.Pin.Cid)
 	if err != nil {
 		return err
 	}
-	gblPinInfo, err := c.client.Status(c.ctx, clusterapi.NewCid(cid), true)
+	gblPinInfo, err := c.client.Status(c.ctx, clusterapi.NewCid(cid), false)
 	if err != nil {
 		return err
 	}
-	for _, pinInfo := range gblPinInfo.PeerMap {
-		currStatus = pinInfo.Status.String()
+	fields, _ := pinwatcher.StatusPatch(ps, gblPinInfo, c.policy, time.Now())
+	if fields == nil {
+		return nil
 	}
-	if currStatus != prevStatus {
-		c.db.Patch(ps.Id, map[string]interface{}{
-			"status": currStatus,
-		})
+	return c.db.Patch(ps.Id, fields)
+}
+
+// findParams returns the statuses, and before and after timestamps in Unix
+// milliseconds, of a Find query for the given parameters. If unix is set, Unix
+// timestamps are accepted.
+func findParams(
+	statuses []models.Status,
+	before, after string,
+	unix bool,
+) ([]string, int64, int64, error) {
+	ss := []string{}
+	for _, s := range statuses {
+		ss = append(ss, s.String())
+	}
+	b := int64(0)
+	if before != "" {
+		t, err := models.ParseTime(before, unix)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf(
+				"%w for 'before' ('%s')", ErrorInvalidTimestamp, before)
+		}
+		b = t.UnixMilli()
+	}
+	a := int64(0)
+	if after != "" {
+		t, err := models.ParseTime(after, unix)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf(
+				"%w for 'after' ('%s')", ErrorInvalidTimestamp, after)
+		}
+		a = t.UnixMilli()
+	}
+	return ss, b, a, nil
+}
+
+// checkUser returns ErrorInvalidUser if the given user ID can not own Pins;
+// it is empty, or the owner matching every owner.
+func checkUser(uid string) error {
+	if uid == "" || uid == pinsdb.AllOwners {
+		return ErrorInvalidUser
 	}
 	return nil
 }
+
+// getPin returns the Pin for the given ID if it is owned by the given user.
+// Pins owned by other users are reported as not found.
+func (c *controller) getPin(uid, id string) (models.PinStatus, error) {
+	if err := checkUser(uid); err != nil {
+		return models.PinStatus{}, err
+	}
+	ps, err := c.db.Get(id)
+	if err == pinsdb.ErrNotFound {
+		return models.PinStatus{}, ErrorPinNotFound
+	} else if err != nil {
+		return models.PinStatus{}, err
+	}
+	if ps.Owner != uid {
+		return models.PinStatus{}, ErrorPinNotFound
+	}
+	return ps, nil
+}
+
+// retireReplaced retires the Pin replaced by the given Pin, if any.
+func (c *controller) retireReplaced(ps models.PinStatus) {
+	id := ps.Info[InfoReplaces]
+	if id == "" {
+		return
+	}
+	prev, err := c.getPin(ps.Owner, id)
+	if err == ErrorPinNotFound {
+		// the replaced pin has already been removed
+		return
+	} else if err != nil {
+		logger.Error(fmt.Sprintf(
+			"Controller: failed to get replaced pin ('%s'): %s",
+			id, err,
+		))
+		return
+	}
+	c.retire(prev)
+}
+
+// retire removes a replaced Pin.
+func (c *controller) retire(ps models.PinStatus) {
+	if err := c.remove(ps); err != nil {
+		logger.Error(fmt.Sprintf(
+			"Controller: failed to remove replaced pin ('%s'): %s",
+			ps.Id, err,
+		))
+	}
+}
+
+// remove deletes the given Pin and unpins its CID from the cluster if no other
+// Pin references it. Content shared by multiple pin requests stays pinned until
+// the last request referencing it is gone. The Pin is restored if its CID fails
+// to unpin, so that the removal can be retried.
+func (c *controller) remove(ps models.PinStatus) error {
+	// the Pin is deleted before counting the references to its CID, so
+	// that concurrent removals of the CID's last Pins cannot all see
+	// another reference and leave it pinned
+	if err := c.db.Delete(ps.Id); err != nil {
+		return err
+	}
+	refs, err := c.db.References(ps.Pin.Cid)
+	if err != nil {
+		return err
+	}
+	if refs > 0 {
+		return nil
+	}
+	// a CID the cluster is not tracking is already unpinned
+	err = c.pinner.Remove(ps.Pin.Cid)
+	if err == nil || pinner.IsNotFound(err) {
+		return nil
+	}
+	if err := c.db.Set(ps); err != nil {
+		logger.Error(fmt.Sprintf(
+			"Controller: failed to restore pin ('%s'): %s",
+			ps.Id, err,
+		))
+	}
+	return fmt.Errorf("failed to unpin CID ('%s'): %s", ps.Pin.Cid, err)
+}
+
+// fail stops watching the given Pin and marks it as failed, recording the
+// cause in the Pin's info.
+func (c *controller) fail(ps models.PinStatus, cause error) {
+	c.watcher.Deregister(ps.Id)
+	info := models.Info{}
+	for k, v := range ps.Info {
+		info[k] = v
+	}
+	info[pinner.InfoStatusDetails] = cause.Error()
+	err := c.db.Patch(ps.Id, map[string]interface{}{
+		"status": models.StatusFailed.String(),
+		"info":   info,
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf(
+			"Controller: failed to mark pin ('%s') as failed: %s",
+			ps.Id, err,
+		))
+	}
+}
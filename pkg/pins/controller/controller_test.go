@@ -1,8 +1,12 @@
 package controller
 
 import (
+	"bytes"
 	"context"
-	"strconv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,18 +15,21 @@ import (
 	ipfscid "github.com/ipfs/go-cid"
 	"github.com/stretchr/testify/require"
 
+	"github.com/crossedbot/axis/pkg/auth"
 	"github.com/crossedbot/axis/pkg/mocks"
+	"github.com/crossedbot/axis/pkg/pinner"
 	pinsdb "github.com/crossedbot/axis/pkg/pins/database"
 	"github.com/crossedbot/axis/pkg/pins/match"
 	"github.com/crossedbot/axis/pkg/pins/models"
 )
 
 func TestFindPins(t *testing.T) {
+	uid := "myuserid"
 	cids := []string{"abc123", "def456", "ghi789"}
 	statuses := []models.Status{models.StatusPinning, models.StatusPinned}
 	name := "helloworld"
-	before := "1621039121"
-	after := "1620967121"
+	before := "2021-05-15T00:38:41.500Z"
+	after := "1620967121" // Unix timestamps are accepted
 	match := models.TextMatchExact
 	limit := 100
 	offset := 10
@@ -34,7 +41,7 @@ func TestFindPins(t *testing.T) {
 		Results: []models.PinStatus{{
 			Id:      "thisispinsid",
 			Status:  "pinned",
-			Created: "1621000000",
+			Created: "2021-05-14T13:46:40.000Z",
 			Pin: models.Pin{
 				Cid:     "abc123",
 				Name:    "helloworld",
@@ -47,42 +54,88 @@ func TestFindPins(t *testing.T) {
 	for _, s := range statuses {
 		statusStrings = append(statusStrings, s.String())
 	}
-	b64, err := strconv.ParseInt(before, 10, 64)
-	require.Nil(t, err)
-	a64, err := strconv.ParseInt(after, 10, 64)
-	require.Nil(t, err)
+	b64 := int64(1621039121500)
+	a64 := int64(1620967121000)
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	mockdb := mocks.NewMockPins(mockCtrl)
 	mockdb.EXPECT().
 		Find(
-			cids, statusStrings, name,
+			uid, cids, statusStrings, name,
 			b64, a64, match.String(), limit,
-			offset, sortBy, meta,
+			offset, nil, sortBy, meta,
 		).
 		Return(expected, nil)
 	ctrl := &controller{db: mockdb}
 	actual, err := ctrl.FindPins(
-		"", cids, name, before,
+		uid, cids, name, before,
 		after, match, statuses,
-		limit, offset, sortByStr,
+		limit, offset, "", sortByStr,
 		meta,
 	)
 	require.Nil(t, err)
 	require.Equal(t, expected, actual)
+	// Unix timestamps are rejected in strict mode
+	ctrl.strictTimestamps = true
+	_, err = ctrl.FindPins(
+		uid, cids, name, before,
+		after, match, statuses,
+		limit, offset, "", sortByStr,
+		meta,
+	)
+	require.True(t, errors.Is(err, ErrorInvalidTimestamp))
+}
+
+func TestFindPinsCursor(t *testing.T) {
+	uid := "myuserid"
+	sortBy := &pinsdb.SortingKey{Field: "created", Ascending: true}
+	cursor := pinsdb.Cursor{Created: 1621000000000, Id: "pin1"}
+	results := []models.PinStatus{
+		{Id: "pin2", Status: "pinned", Created: "2021-05-14T13:46:40.000Z"},
+		{Id: "pin3", Status: "pinned", Created: "2021-05-14T13:46:41.000Z"},
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Find(uid, nil, []string{}, "", int64(0), int64(0), "exact", 2, 0, &cursor,
+			sortBy, nil).
+		Return(models.Pins{Count: 2, Total: 3, Results: results}, nil)
+	ctrl := &controller{db: mockdb}
+	actual, err := ctrl.FindPins(uid, nil, "", "", "", models.TextMatchExact,
+		nil, 2, 0, cursor.String(), "created", nil)
+	require.Nil(t, err)
+	next, err := pinsdb.ParseCursor(actual.Next)
+	require.Nil(t, err)
+	require.Equal(t, pinsdb.Cursor{Created: 1621000001000, Id: "pin3"}, next)
+
+	// the last page has no next cursor
+	mockdb.EXPECT().
+		Find(uid, nil, []string{}, "", int64(0), int64(0), "exact", 2, 0, &next,
+			sortBy, nil).
+		Return(models.Pins{Count: 1, Total: 1, Results: results[:1]}, nil)
+	actual, err = ctrl.FindPins(uid, nil, "", "", "", models.TextMatchExact,
+		nil, 2, 0, actual.Next, "created", nil)
+	require.Nil(t, err)
+	require.Empty(t, actual.Next)
+
+	_, err = ctrl.FindPins(uid, nil, "", "", "", models.TextMatchExact,
+		nil, 2, 0, "not a cursor", "created", nil)
+	require.True(t, errors.Is(err, pinsdb.ErrInvalidCursor))
 }
 
 func TestGetPin(t *testing.T) {
 	expected := models.PinStatus{
 		Id:      "thispinsid",
 		Status:  "pinned",
-		Created: "1621000000",
+		Created: "2021-05-14T13:46:40.000Z",
 		Pin: models.Pin{
 			Cid:     "abc123",
 			Name:    "helloworld",
 			Origins: []string{"somewherefaraway"},
 			Meta:    models.Info{"uid": "myuserid"},
 		},
+		Owner: "myuserid",
 	}
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -94,11 +147,54 @@ func TestGetPin(t *testing.T) {
 		Get(expected.Id).
 		Return(expected, nil)
 	ctrl := &controller{db: mockdb}
-	actual, err := ctrl.GetPin("", expected.Id)
+	actual, err := ctrl.GetPin("myuserid", expected.Id)
 	require.Nil(t, err)
 	require.Equal(t, expected, actual)
 }
 
+func TestGetPinNotOwned(t *testing.T) {
+	ps := models.PinStatus{
+		Id:      "thispinsid",
+		Status:  "pinned",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:  "abc123",
+			Name: "helloworld",
+		},
+		Owner: "someoneelse",
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Get(ps.Id).
+		Return(ps, nil)
+	ctrl := &controller{db: mockdb}
+	_, err := ctrl.GetPin("myuserid", ps.Id)
+	require.Equal(t, ErrorPinNotFound, err)
+}
+
+func TestInvalidUser(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	// the database is never queried for an invalid user
+	ctrl := &controller{db: mocks.NewMockPins(mockCtrl)}
+	for _, uid := range []string{"", pinsdb.AllOwners} {
+		_, err := ctrl.FindPins(uid, nil, "", "", "", models.TextMatchExact,
+			nil, 10, 0, "", "", nil)
+		require.Equal(t, ErrorInvalidUser, err)
+		_, err = ctrl.GetPin(uid, "thispinsid")
+		require.Equal(t, ErrorInvalidUser, err)
+		_, err = ctrl.CreatePin(uid, models.Pin{Cid: "abc123"})
+		require.Equal(t, ErrorInvalidUser, err)
+		_, err = ctrl.PatchPin(uid, "thispinsid", models.Pin{})
+		require.Equal(t, ErrorInvalidUser, err)
+		require.Equal(t, ErrorInvalidUser, ctrl.RemovePin(uid, "thispinsid"))
+		_, err = ctrl.FindApiKeys(uid)
+		require.Equal(t, ErrorInvalidUser, err)
+	}
+}
+
 func TestCreatePin(t *testing.T) {
 	pin := models.Pin{
 		Cid:     "abc123",
@@ -109,8 +205,9 @@ func TestCreatePin(t *testing.T) {
 	expected := models.PinStatus{
 		Id:      "thispinsid",
 		Status:  "pinned",
-		Created: "1621000000",
+		Created: "2021-05-14T13:46:40.000Z",
 		Pin:     pin,
+		Owner:   "myuserid",
 	}
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -133,50 +230,233 @@ func TestCreatePin(t *testing.T) {
 		Register(
 			expected,
 			clusterapi.TrackerStatusPinned,
-			1*time.Minute,
+			gomock.Nil(),
 		)
-	mockWatcher.EXPECT().Deregister(expected.Id)
 	ctrl := &controller{
 		db:      mockdb,
 		pinner:  mockPinner,
 		watcher: mockWatcher,
 	}
-	actual, err := ctrl.CreatePin("", pin)
+	actual, err := ctrl.CreatePin("myuserid", pin)
 	require.Nil(t, err)
 	require.Equal(t, expected, actual)
 	time.Sleep(1 * time.Millisecond)
 }
 
-func TestUpdatePin(t *testing.T) {
+func TestCreatePinQuota(t *testing.T) {
+	pin := models.Pin{Cid: "abc123", Name: "helloworld"}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Find("myuserid", nil, nil, "", int64(0), int64(0), "", 1, 0, nil,
+			nil, nil).
+		Return(models.Pins{Count: 1, Total: 2}, nil)
+	ctrl := &controller{db: mockdb, maxPins: 2}
+	_, err := ctrl.CreatePin("myuserid", pin)
+	require.Equal(t, ErrorQuotaExceeded, err)
+}
+
+func TestCreatePinMaxName(t *testing.T) {
+	pin := models.Pin{
+		Cid:  "abc123",
+		Name: strings.Repeat("a", MaxNameLimit+1),
+	}
+	ctrl := &controller{}
+	_, err := ctrl.CreatePin("myuserid", pin)
+	require.Equal(t, ErrorMaxNameLimit, err)
+	_, err = ctrl.PatchPin("myuserid", "thispinsid", pin)
+	require.Equal(t, ErrorMaxNameLimit, err)
+}
+
+func TestCreatePinFailure(t *testing.T) {
 	pin := models.Pin{
 		Cid:     "abc123",
 		Name:    "helloworld",
-		Origins: []string{"somewherefaraway"},
-		Meta:    models.Info{"uid": "myuserid"},
+		Origins: []string{"notamultiaddr"},
 	}
 	expected := models.PinStatus{
 		Id:      "thispinsid",
-		Status:  "pinned",
-		Created: "1621000000",
+		Status:  "queued",
+		Created: "2021-05-14T13:46:40.000Z",
 		Pin:     pin,
+		Info:    models.Info{"a": "one"},
+		Owner:   "myuserid",
 	}
+	pinErr := errors.New("invalid multiaddr")
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Set(match.PinStatus(pin)).
+		Return(nil)
+	mockdb.EXPECT().
+		Get(gomock.Any()).
+		Return(expected, nil)
+	failed := make(chan struct{})
 	mockdb.EXPECT().
 		Patch(expected.Id, map[string]interface{}{
-			"name":    pin.Name,
-			"origins": pin.Origins,
-			"meta":    pin.Meta,
+			"status": "failed",
+			"info": models.Info{
+				"a":              "one",
+				"status_details": pinErr.Error(),
+			},
 		}).
+		Do(func(string, map[string]interface{}) { close(failed) }).
+		Return(nil)
+	mockPinner := mocks.NewMockPinner(mockCtrl)
+	mockPinner.EXPECT().
+		Delegates().
+		Return([]string{}, nil)
+	mockPinner.EXPECT().
+		Add(pin).
+		Return(pinErr)
+	mockWatcher := mocks.NewMockPinWatcher(mockCtrl)
+	mockWatcher.EXPECT().
+		Register(
+			expected,
+			clusterapi.TrackerStatusPinned,
+			gomock.Nil(),
+		)
+	mockWatcher.EXPECT().
+		Deregister(expected.Id)
+	ctrl := &controller{
+		db:      mockdb,
+		pinner:  mockPinner,
+		watcher: mockWatcher,
+	}
+	actual, err := ctrl.CreatePin("myuserid", pin)
+	require.Nil(t, err)
+	require.Equal(t, expected, actual)
+	<-failed
+}
+
+func TestUpdatePin(t *testing.T) {
+	prev := models.PinStatus{
+		Id:      "thispinsid",
+		Status:  "pinned",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:  "abc123",
+			Name: "helloworld",
+		},
+		Owner: "myuserid",
+	}
+	pin := models.Pin{
+		Cid:     "def456",
+		Name:    "helloworld",
+		Origins: []string{"somewherefaraway"},
+		Meta:    models.Info{"uid": "myuserid"},
+	}
+	expected := models.PinStatus{
+		Id:      "thisnewpinsid",
+		Status:  "queued",
+		Created: "2021-05-14T13:46:41.000Z",
+		Pin:     pin,
+		Info:    models.Info{InfoReplaces: prev.Id},
+		Owner:   "myuserid",
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	// the previous pin is retrieved again, by its ID in the new pin's info,
+	// once the new pin is pinned
+	mockdb.EXPECT().
+		Get(prev.Id).
+		Return(prev, nil).
+		Times(2)
+	mockdb.EXPECT().
+		Set(match.PinStatus(pin)).
 		Return(nil)
 	mockdb.EXPECT().
-		Get(expected.Id).
+		Get(gomock.Any()).
 		Return(expected, nil)
-	ctrl := &controller{db: mockdb}
-	actual, err := ctrl.UpdatePin("", expected.Id, pin)
+	// the previous pin is retired once the new pin is pinned
+	mockdb.EXPECT().
+		Delete(prev.Id).
+		Return(nil)
+	mockdb.EXPECT().
+		References(prev.Pin.Cid).
+		Return(0, nil)
+	mockPinner := mocks.NewMockPinner(mockCtrl)
+	mockPinner.EXPECT().
+		Delegates().
+		Return([]string{}, nil)
+	updated := make(chan struct{})
+	mockPinner.EXPECT().
+		Update(prev.Pin.Cid, pin).
+		Do(func(string, models.Pin) { close(updated) }).
+		Return(nil)
+	mockPinner.EXPECT().
+		Remove(prev.Pin.Cid).
+		Return(nil)
+	mockWatcher := mocks.NewMockPinWatcher(mockCtrl)
+	mockWatcher.EXPECT().
+		Register(
+			expected,
+			clusterapi.TrackerStatusPinned,
+			gomock.Any(),
+		).
+		Do(func(
+			p models.PinStatus,
+			_ clusterapi.TrackerStatus,
+			onTarget func(models.PinStatus),
+		) {
+			onTarget(p)
+		})
+	ctrl := &controller{
+		db:      mockdb,
+		pinner:  mockPinner,
+		watcher: mockWatcher,
+	}
+	actual, err := ctrl.UpdatePin("myuserid", prev.Id, pin)
 	require.Nil(t, err)
 	require.Equal(t, expected, actual)
+	<-updated
+}
+
+func TestRetireReplaced(t *testing.T) {
+	prev := models.PinStatus{
+		Id:    "thispinsid",
+		Pin:   models.Pin{Cid: "abc123"},
+		Owner: "myuserid",
+	}
+	ps := models.PinStatus{
+		Id:    "thisnewpinsid",
+		Pin:   models.Pin{Cid: "def456"},
+		Info:  models.Info{InfoReplaces: prev.Id},
+		Owner: "myuserid",
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Get(prev.Id).
+		Return(prev, nil)
+	mockdb.EXPECT().
+		Delete(prev.Id).
+		Return(nil)
+	mockdb.EXPECT().
+		References(prev.Pin.Cid).
+		Return(0, nil)
+	mockPinner := mocks.NewMockPinner(mockCtrl)
+	mockPinner.EXPECT().
+		Remove(prev.Pin.Cid).
+		Return(nil)
+	ctrl := &controller{db: mockdb, pinner: mockPinner}
+	ctrl.retireReplaced(ps)
+	// a replaced pin that is gone, or owned by another user, is skipped
+	mockdb.EXPECT().
+		Get(prev.Id).
+		Return(models.PinStatus{}, pinsdb.ErrNotFound)
+	ctrl.retireReplaced(ps)
+	prev.Owner = "someoneelse"
+	mockdb.EXPECT().
+		Get(prev.Id).
+		Return(prev, nil)
+	ctrl.retireReplaced(ps)
+	// pins replacing no pin are skipped
+	ctrl.retireReplaced(prev)
 }
 
 func TestPatchPin(t *testing.T) {
@@ -189,12 +469,16 @@ func TestPatchPin(t *testing.T) {
 	expected := models.PinStatus{
 		Id:      "thispinsid",
 		Status:  "pinned",
-		Created: "1621000000",
+		Created: "2021-05-14T13:46:40.000Z",
 		Pin:     pin,
+		Owner:   "myuserid",
 	}
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Get(expected.Id).
+		Return(expected, nil)
 	mockdb.EXPECT().
 		Patch(expected.Id, map[string]interface{}{
 			"name":    pin.Name,
@@ -206,7 +490,7 @@ func TestPatchPin(t *testing.T) {
 		Get(expected.Id).
 		Return(expected, nil)
 	ctrl := &controller{db: mockdb}
-	actual, err := ctrl.PatchPin("", expected.Id, pin)
+	actual, err := ctrl.PatchPin("myuserid", expected.Id, pin)
 	require.Nil(t, err)
 	require.Equal(t, expected, actual)
 }
@@ -215,13 +499,14 @@ func TestRemovePin(t *testing.T) {
 	expected := models.PinStatus{
 		Id:      "thispinsid",
 		Status:  "pinned",
-		Created: "1621000000",
+		Created: "2021-05-14T13:46:40.000Z",
 		Pin: models.Pin{
 			Cid:     "abc123",
 			Name:    "helloworld",
 			Origins: []string{"somewherefaraway"},
 			Meta:    models.Info{"uid": "myuserid"},
 		},
+		Owner: "myuserid",
 	}
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -232,27 +517,151 @@ func TestRemovePin(t *testing.T) {
 	mockdb.EXPECT().
 		Delete(expected.Id).
 		Return(nil)
+	mockdb.EXPECT().
+		References(expected.Pin.Cid).
+		Return(0, nil)
 	mockPinner := mocks.NewMockPinner(mockCtrl)
 	mockPinner.EXPECT().
 		Remove(expected.Pin.Cid).
 		Return(nil)
 	ctrl := &controller{db: mockdb, pinner: mockPinner}
-	err := ctrl.RemovePin("", expected.Id)
+	err := ctrl.RemovePin("myuserid", expected.Id)
+	require.Nil(t, err)
+}
+
+func TestRemovePinSharedCid(t *testing.T) {
+	ps := models.PinStatus{
+		Id:      "thispinsid",
+		Status:  "pinned",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:  "abc123",
+			Name: "helloworld",
+		},
+		Owner: "myuserid",
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Get(ps.Id).
+		Return(ps, nil)
+	mockdb.EXPECT().
+		Delete(ps.Id).
+		Return(nil)
+	// another pin request still references the CID
+	mockdb.EXPECT().
+		References(ps.Pin.Cid).
+		Return(1, nil)
+	mockPinner := mocks.NewMockPinner(mockCtrl)
+	ctrl := &controller{db: mockdb, pinner: mockPinner}
+	err := ctrl.RemovePin("myuserid", ps.Id)
 	require.Nil(t, err)
 }
 
+func TestRemovePinUnpinFailure(t *testing.T) {
+	ps := models.PinStatus{
+		Id:      "thispinsid",
+		Status:  "pinned",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:  "abc123",
+			Name: "helloworld",
+		},
+		Owner: "myuserid",
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Get(ps.Id).
+		Return(ps, nil)
+	mockdb.EXPECT().
+		Delete(ps.Id).
+		Return(nil)
+	mockdb.EXPECT().
+		References(ps.Pin.Cid).
+		Return(0, nil)
+	// the pin is restored so that the removal can be retried
+	mockPinner := mocks.NewMockPinner(mockCtrl)
+	mockPinner.EXPECT().
+		Remove(ps.Pin.Cid).
+		Return(errors.New("cluster unreachable"))
+	mockdb.EXPECT().
+		Set(ps).
+		Return(nil)
+	ctrl := &controller{db: mockdb, pinner: mockPinner}
+	err := ctrl.RemovePin("myuserid", ps.Id)
+	require.NotNil(t, err)
+}
+
+func TestRemovePinUnpinNotFound(t *testing.T) {
+	ps := models.PinStatus{
+		Id:      "thispinsid",
+		Status:  "failed",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:  "abc123",
+			Name: "helloworld",
+		},
+		Owner: "myuserid",
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Get(ps.Id).
+		Return(ps, nil)
+	mockdb.EXPECT().
+		Delete(ps.Id).
+		Return(nil)
+	mockdb.EXPECT().
+		References(ps.Pin.Cid).
+		Return(0, nil)
+	// the cluster is not tracking the CID; the pin stays removed
+	mockPinner := mocks.NewMockPinner(mockCtrl)
+	mockPinner.EXPECT().
+		Remove(ps.Pin.Cid).
+		Return(clusterapi.Error{Code: 404, Message: "not found"})
+	ctrl := &controller{db: mockdb, pinner: mockPinner}
+	require.Nil(t, ctrl.RemovePin("myuserid", ps.Id))
+}
+
+func TestRemovePinNotOwned(t *testing.T) {
+	ps := models.PinStatus{
+		Id:      "thispinsid",
+		Status:  "pinned",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:  "abc123",
+			Name: "helloworld",
+		},
+		Owner: "someoneelse",
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Get(ps.Id).
+		Return(ps, nil)
+	ctrl := &controller{db: mockdb}
+	err := ctrl.RemovePin("myuserid", ps.Id)
+	require.Equal(t, ErrorPinNotFound, err)
+}
+
 func TestUpdatePinStatus(t *testing.T) {
 	ctx := context.Background()
 	ps := models.PinStatus{
 		Id:      "thispinsid",
 		Status:  "pinned",
-		Created: "1621000000",
+		Created: "2021-05-14T13:46:40.000Z",
 		Pin: models.Pin{
 			Cid:     "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv",
 			Name:    "helloworld",
 			Origins: []string{"somewherefaraway"},
 			Meta:    models.Info{"uid": "myuserid"},
 		},
+		Owner: "myuserid",
 	}
 	cid, err := ipfscid.Decode(ps.Pin.Cid)
 	require.Nil(t, err)
@@ -264,7 +673,7 @@ func TestUpdatePinStatus(t *testing.T) {
 		Return(ps, nil)
 	mockIpfsClient := mocks.NewMockClient(mockCtrl)
 	mockIpfsClient.EXPECT().
-		Status(ctx, clusterapi.NewCid(cid), true).
+		Status(ctx, clusterapi.NewCid(cid), false).
 		Return(clusterapi.GlobalPinInfo{
 			PeerMap: map[string]clusterapi.PinInfoShort{
 				"peer": clusterapi.PinInfoShort{
@@ -272,6 +681,316 @@ func TestUpdatePinStatus(t *testing.T) {
 				},
 			},
 		}, nil)
-	ctrl := &controller{ctx: ctx, db: mockdb, client: mockIpfsClient}
-	require.Nil(t, ctrl.UpdatePinStatus("", ps.Id))
+	// the status is unchanged, but the cluster's status is recorded
+	mockdb.EXPECT().
+		Patch(ps.Id, match.StatusPatch(map[string]interface{}{
+			"status": "pinned",
+			"info": models.Info{
+				"cluster_status":   "pinned",
+				"peer_status.peer": "pinned",
+			},
+		})).
+		Return(nil)
+	ctrl := &controller{
+		ctx:    ctx,
+		db:     mockdb,
+		client: mockIpfsClient,
+		policy: pinner.DefaultStatusPolicy,
+	}
+	require.Nil(t, ctrl.UpdatePinStatus("myuserid", ps.Id))
+}
+
+func TestExportPins(t *testing.T) {
+	pins := []models.PinStatus{
+		{
+			Id:      "pin1",
+			Status:  "pinned",
+			Created: "2021-05-14T13:46:40.000Z",
+			Pin: models.Pin{
+				Cid:  "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv",
+				Name: "hello, world",
+				Meta: models.Info{"url": "https://example.com/a,b"},
+			},
+			Owner: "alice",
+		},
+		{
+			Id:      "pin2",
+			Status:  "queued",
+			Created: "2021-05-14T13:46:41.000Z",
+			Pin: models.Pin{
+				Cid: "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+			},
+			Owner: "bob",
+		},
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	// the pins of all users are exported
+	mockdb.EXPECT().
+		Find(
+			pinsdb.AllOwners, nil, []string{"pinned", "queued"}, "", int64(0),
+			int64(1620000000000), "exact", exportPageSize, 0, nil,
+			&pinsdb.SortingKey{Field: "created", Ascending: true},
+			models.Info{},
+		).
+		Return(models.Pins{Count: 2, Total: 2, Results: pins}, nil)
+	ctrl := &controller{db: mockdb}
+	var buf bytes.Buffer
+	n, err := ctrl.ExportPins(
+		&buf, nil, "", "", "1620000000", models.TextMatchExact,
+		[]models.Status{models.StatusPinned, models.StatusQueued},
+		models.Info{},
+	)
+	require.Nil(t, err)
+	require.Equal(t, 2, n)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	for i, line := range lines {
+		var rec models.PinRecord
+		require.Nil(t, json.Unmarshal([]byte(line), &rec))
+		require.Equal(t, pins[i], rec.ToPinStatus())
+	}
+	_, err = ctrl.ExportPins(&buf, nil, "", "", "notanumber",
+		models.TextMatchExact, nil, nil)
+	require.NotNil(t, err)
+}
+
+func TestExportPinsIncomplete(t *testing.T) {
+	page := make([]models.PinStatus, exportPageSize)
+	for i := range page {
+		page[i] = models.PinStatus{
+			Id:      fmt.Sprintf("pin%d", i),
+			Status:  "pinned",
+			Created: "2021-05-14T13:46:40.000Z",
+			Pin: models.Pin{
+				Cid: "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv",
+			},
+			Owner: "alice",
+		}
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	gomock.InOrder(
+		mockdb.EXPECT().
+			Find(pinsdb.AllOwners, nil, gomock.Any(), "", int64(0),
+				int64(0), "exact", exportPageSize, 0, nil,
+				gomock.Any(), nil).
+			Return(models.Pins{Count: len(page), Results: page}, nil),
+		mockdb.EXPECT().
+			Find(pinsdb.AllOwners, nil, gomock.Any(), "", int64(0),
+				int64(0), "exact", exportPageSize, 0, gomock.Not(nil),
+				gomock.Any(), nil).
+			Return(models.Pins{}, errors.New("connection refused")),
+	)
+	ctrl := &controller{db: mockdb}
+	var buf bytes.Buffer
+	n, err := ctrl.ExportPins(&buf, nil, "", "", "",
+		models.TextMatchExact, nil, nil)
+	require.NotNil(t, err)
+	require.Equal(t, exportPageSize, n)
+	// the export ends with a record of the error
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, exportPageSize+1)
+	var failure models.Failure
+	require.Nil(t, json.Unmarshal([]byte(lines[exportPageSize]), &failure))
+	require.Equal(t, "PROCESSING_REQUEST", failure.Error.Reason)
+
+	// which is refused by the import
+	mockdb.EXPECT().
+		Set(gomock.Any()).
+		Return(nil).
+		Times(exportPageSize)
+	n, err = ctrl.ImportPins(&buf, false, true)
+	require.True(t, errors.Is(err, ErrorInvalidPinRecord))
+	require.Equal(t, exportPageSize, n)
+}
+
+func TestImportPins(t *testing.T) {
+	ps := models.PinStatus{
+		Id:      "pin1",
+		Status:  "pinned",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:  "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv",
+			Name: "helloworld",
+		},
+		Delegates: []string{"/ip4/10.0.0.1/tcp/4001"},
+		Info:      models.Info{"cluster_status": "pinned"},
+		Owner:     "alice",
+	}
+	b, err := json.Marshal(models.NewPinRecord(ps))
+	require.Nil(t, err)
+	records := string(b) + "\n" + string(b) + "\n"
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Set(ps).
+		Return(nil).
+		Times(2)
+	ctrl := &controller{db: mockdb}
+	n, err := ctrl.ImportPins(strings.NewReader(records), false, true)
+	require.Nil(t, err)
+	require.Equal(t, 2, n)
+
+	// existing pins are only replaced if overwriting
+	gomock.InOrder(
+		mockdb.EXPECT().
+			Get(ps.Id).
+			Return(models.PinStatus{}, pinsdb.ErrNotFound),
+		mockdb.EXPECT().
+			Set(ps).
+			Return(nil),
+		mockdb.EXPECT().
+			Get(ps.Id).
+			Return(ps, nil),
+	)
+	n, err = ctrl.ImportPins(strings.NewReader(records), false, false)
+	require.True(t, errors.Is(err, ErrorPinExists))
+	require.Equal(t, 1, n)
+
+	// invalid records stop the import
+	n, err = ctrl.ImportPins(
+		strings.NewReader(`{"requestid": ""}`), false, false)
+	require.True(t, errors.Is(err, ErrorInvalidPinRecord))
+	require.Equal(t, 0, n)
+	n, err = ctrl.ImportPins(strings.NewReader("notjson"), false, false)
+	require.True(t, errors.Is(err, ErrorInvalidPinRecord))
+	require.Equal(t, 0, n)
+	for _, owner := range []string{"", pinsdb.AllOwners} {
+		unowned := ps
+		unowned.Owner = owner
+		b, err := json.Marshal(models.NewPinRecord(unowned))
+		require.Nil(t, err)
+		n, err = ctrl.ImportPins(bytes.NewReader(b), false, true)
+		require.True(t, errors.Is(err, ErrorInvalidPinRecord), owner)
+		require.Equal(t, 0, n)
+	}
+
+	// repinning requires an IPFS cluster
+	offline := NewOffline(context.Background(), mockdb)
+	n, err = offline.ImportPins(strings.NewReader(records), true, true)
+	require.Equal(t, ErrorNoCluster, err)
+	require.Equal(t, 0, n)
+}
+
+func TestImportPinsRepin(t *testing.T) {
+	ps := models.PinStatus{
+		Id:      "pin1",
+		Status:  "pinned",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:  "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv",
+			Name: "helloworld",
+		},
+		Info:  models.Info{"cluster_status": "pinned"},
+		Owner: "alice",
+	}
+	b, err := json.Marshal(models.NewPinRecord(ps))
+	require.Nil(t, err)
+	// the pin is queued on the target cluster
+	expected := ps
+	expected.Status = "queued"
+	expected.Delegates = []string{"/ip4/10.0.0.2/tcp/4001"}
+	expected.Info = models.Info{}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		Get(ps.Id).
+		Return(models.PinStatus{}, pinsdb.ErrNotFound)
+	mockdb.EXPECT().
+		Set(expected).
+		Return(nil)
+	mockPinner := mocks.NewMockPinner(mockCtrl)
+	mockPinner.EXPECT().
+		Delegates().
+		Return(expected.Delegates, nil)
+	mockPinner.EXPECT().
+		Add(ps.Pin).
+		Return(nil)
+	mockWatcher := mocks.NewMockPinWatcher(mockCtrl)
+	mockWatcher.EXPECT().
+		Register(expected, clusterapi.TrackerStatusPinned, gomock.Nil())
+	ctrl := &controller{
+		db:      mockdb,
+		pinner:  mockPinner,
+		watcher: mockWatcher,
+	}
+	n, err := ctrl.ImportPins(bytes.NewReader(b), true, false)
+	require.Nil(t, err)
+	require.Equal(t, 1, n)
+}
+
+func TestCreateApiKey(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	var stored models.ApiKey
+	mockdb.EXPECT().
+		SetApiKey(gomock.Any()).
+		DoAndReturn(func(key models.ApiKey) error {
+			stored = key
+			return nil
+		})
+	ctrl := &controller{db: mockdb}
+	scopes := []string{auth.ScopePinsRead}
+	key, err := ctrl.CreateApiKey("myuserid", "user", scopes, "ci")
+	require.Nil(t, err)
+	require.True(t, auth.IsApiKey(key.Key))
+	require.Equal(t, key.Key[:len(key.Prefix)], key.Prefix)
+	require.Equal(t, "ci", key.Name)
+	// only the hash of the key is stored
+	require.Equal(t, "", stored.Key)
+	require.Equal(t, auth.HashApiKey(key.Key), stored.Hash)
+	require.Equal(t, "myuserid", stored.Owner)
+	require.Equal(t, "user", stored.Grant)
+	require.Equal(t, scopes, stored.Scopes)
+	_, err = ctrl.CreateApiKey(
+		"myuserid", "user", nil, strings.Repeat("a", MaxNameLimit+1))
+	require.Equal(t, ErrorMaxNameLimit, err)
+}
+
+func TestAuthenticateApiKey(t *testing.T) {
+	expected := models.ApiKey{
+		Id:      "thiskeysid",
+		Prefix:  "axis_abcdef",
+		Created: "2021-05-14T13:46:40.000Z",
+		Hash:    auth.HashApiKey("axis_abcdefghij"),
+		Owner:   "myuserid",
+		Grant:   "user",
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		GetApiKey(expected.Hash).
+		Return(expected, nil)
+	mockdb.EXPECT().
+		GetApiKey(auth.HashApiKey("axis_unknown")).
+		Return(models.ApiKey{}, pinsdb.ErrApiKeyNotFound)
+	ctrl := &controller{db: mockdb}
+	actual, err := ctrl.AuthenticateApiKey("axis_abcdefghij")
+	require.Nil(t, err)
+	require.Equal(t, expected, actual)
+	_, err = ctrl.AuthenticateApiKey("axis_unknown")
+	require.Equal(t, ErrorApiKeyNotFound, err)
+}
+
+func TestRevokeApiKey(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockdb := mocks.NewMockPins(mockCtrl)
+	mockdb.EXPECT().
+		DeleteApiKey("myuserid", "thiskeysid").
+		Return(nil)
+	mockdb.EXPECT().
+		DeleteApiKey("myuserid", "otherkeysid").
+		Return(pinsdb.ErrApiKeyNotFound)
+	ctrl := &controller{db: mockdb}
+	require.Nil(t, ctrl.RevokeApiKey("myuserid", "thiskeysid"))
+	require.Equal(t, ErrorApiKeyNotFound,
+		ctrl.RevokeApiKey("myuserid", "otherkeysid"))
 }
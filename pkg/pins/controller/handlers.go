@@ -2,14 +2,19 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/crossedbot/common/golang/logger"
 	"github.com/crossedbot/common/golang/server"
 	middleware "github.com/crossedbot/simplemiddleware"
 
+	"github.com/crossedbot/axis/pkg/auth"
+	pinsdb "github.com/crossedbot/axis/pkg/pins/database"
 	"github.com/crossedbot/axis/pkg/pins/models"
 )
 
@@ -25,74 +30,13 @@ func FindPins(w http.ResponseWriter, r *http.Request, p server.Parameters) {
 		logger.Info("no user id")
 	}
 	query := r.URL.Query()
-	// get cid parameter(s)
-	cids, present := query["cid"]
-	if present {
-		if len(cids) > MaxPinLimit {
-			server.JsonResponse(w, models.NewFailure(
-				models.ErrMaxPinLimitCode,
-				fmt.Sprintf(
-					"max cid limit exceeded [1 .. %d]",
-					MaxPinLimit,
-				),
-			), http.StatusBadRequest)
-			return
-		}
-	}
-	// partial or fullmatch name of pins
-	name := query.Get("name")
-	if len(name) > MaxNameLimit {
-		server.JsonResponse(w, models.NewFailure(
-			models.ErrMaxPinLimitCode,
-			fmt.Sprintf(
-				"max name limit exceeded %d characters",
-				MaxNameLimit,
-			),
-		), http.StatusBadRequest)
+	filter, failure := parsePinFilter(query)
+	if failure != nil {
+		server.JsonResponse(w, failure, http.StatusBadRequest)
 		return
 	}
-	// get text matching strategy
-	matchStr := query.Get("match")
-	match := models.TextMatchExact
-	if matchStr != "" {
-		match, err = models.ToTextMatch(matchStr)
-		if err != nil {
-			// unknown text matching
-			server.JsonResponse(w, models.NewFailure(
-				models.ErrUnknownTextMatchStringCode,
-				fmt.Sprintf("%s \"%s\"", err.Error(), matchStr),
-			), http.StatusBadRequest)
-			return
-		}
-	}
-	// get status parameter(s)
-	statuses := []models.Status{}
-	statusStrings, present := query["status"]
-	if present {
-		// create status map to remove duplicates, and append them to the status
-		// list
-		statusMap := make(map[models.Status]struct{})
-		for _, s := range statusStrings {
-			status, err := models.ToStatus(s)
-			if err != nil {
-				// unknown status
-				server.JsonResponse(w, models.NewFailure(
-					models.ErrUnknownStatusStringCode,
-					fmt.Sprintf("%s \"%s\"", err.Error(), s),
-				), http.StatusBadRequest)
-				return
-			}
-			statusMap[status] = struct{}{}
-		}
-		for s, _ := range statusMap {
-			statuses = append(statuses, s)
-		}
-	}
-	// get time range parameters
-	before := query.Get("before")
-	after := query.Get("after")
 	// get limit parameter
-	limit := 10
+	limit := pinsdb.DefaultLimit
 	if v := query.Get("limit"); v != "" {
 		var err error
 		limit, err = strconv.Atoi(v)
@@ -103,11 +47,11 @@ func FindPins(w http.ResponseWriter, r *http.Request, p server.Parameters) {
 			), http.StatusBadRequest)
 			return
 		}
-		if limit > MaxPinLimit {
+		if limit < 1 || limit > MaxPinLimit {
 			server.JsonResponse(w, models.NewFailure(
 				models.ErrMaxPinLimitCode,
 				fmt.Sprintf(
-					"max limit exceeded [1 .. %d]",
+					"limit out of range [1 .. %d]",
 					MaxPinLimit,
 				),
 			), http.StatusBadRequest)
@@ -155,28 +99,14 @@ func FindPins(w http.ResponseWriter, r *http.Request, p server.Parameters) {
 		}
 		sortBy = v
 	}
-	// get meta data parameter
-	meta := make(map[string]string)
-	if metaString := query.Get("meta"); metaString != "" {
-		if err := json.Unmarshal([]byte(metaString), &meta); err != nil {
-			server.JsonResponse(w, models.NewFailure(
-				models.ErrFailedConversionCode,
-				fmt.Sprintf("failed to parse meta data; %s", err),
-			), http.StatusBadRequest)
-			return
-		}
-	}
 	pins, err := Ctrl().FindPins(
-		uid, cids, name,
-		before, after, match,
-		statuses, limit, offset,
-		sortBy, meta,
+		uid, filter.cids, filter.name,
+		filter.before, filter.after, filter.match,
+		filter.statuses, limit, offset, query.Get("cursor"),
+		sortBy, filter.meta,
 	)
 	if err != nil {
-		server.JsonResponse(w, models.NewFailure(
-			models.ErrProcessingRequestCode,
-			fmt.Sprintf("failed to find pins; %s", err),
-		), http.StatusInternalServerError)
+		failureResponse(w, "find pins", err)
 		return
 	}
 	server.JsonResponse(w, &pins, http.StatusOK)
@@ -196,17 +126,8 @@ func GetPin(w http.ResponseWriter, r *http.Request, p server.Parameters) {
 		return
 	}
 	pinStatus, err := Ctrl().GetPin(uid, id)
-	if err == ErrorPinNotFound {
-		server.JsonResponse(w, models.NewFailure(
-			models.ErrProcessingRequestCode,
-			fmt.Sprintf("failed to get pin; %s", err),
-		), http.StatusNotFound)
-		return
-	} else if err != nil {
-		server.JsonResponse(w, models.NewFailure(
-			models.ErrProcessingRequestCode,
-			fmt.Sprintf("failed to get pin; %s", err),
-		), http.StatusInternalServerError)
+	if err != nil {
+		failureResponse(w, "get pin", err)
 		return
 	}
 	server.JsonResponse(w, &pinStatus, http.StatusOK)
@@ -229,10 +150,7 @@ func CreatePin(w http.ResponseWriter, r *http.Request, p server.Parameters) {
 	pinStatus, err := Ctrl().CreatePin(uid, pin)
 	if err != nil {
 		logger.Error(err)
-		server.JsonResponse(w, models.NewFailure(
-			models.ErrProcessingRequestCode,
-			fmt.Sprintf("failed to create pin; %s", err),
-		), http.StatusInternalServerError)
+		failureResponse(w, "create pin", err)
 		return
 	}
 	server.JsonResponse(w, &pinStatus, http.StatusAccepted)
@@ -261,10 +179,7 @@ func UpdatePin(w http.ResponseWriter, r *http.Request, p server.Parameters) {
 	}
 	pinStatus, err := Ctrl().UpdatePin(uid, id, pin)
 	if err != nil {
-		server.JsonResponse(w, models.NewFailure(
-			models.ErrProcessingRequestCode,
-			fmt.Sprintf("failed to update pin; %s", err),
-		), http.StatusInternalServerError)
+		failureResponse(w, "update pin", err)
 		return
 	}
 	server.JsonResponse(w, &pinStatus, http.StatusAccepted)
@@ -293,10 +208,7 @@ func PatchPin(w http.ResponseWriter, r *http.Request, p server.Parameters) {
 	}
 	pinStatus, err := Ctrl().PatchPin(uid, id, pin)
 	if err != nil {
-		server.JsonResponse(w, models.NewFailure(
-			models.ErrProcessingRequestCode,
-			fmt.Sprintf("failed to update pin; %s", err),
-		), http.StatusInternalServerError)
+		failureResponse(w, "update pin", err)
 		return
 	}
 	server.JsonResponse(w, &pinStatus, http.StatusAccepted)
@@ -317,11 +229,277 @@ func RemovePin(w http.ResponseWriter, r *http.Request, p server.Parameters) {
 	}
 	err := Ctrl().RemovePin(uid, id)
 	if err != nil {
+		failureResponse(w, "remove pin", err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func GetReconciliation(w http.ResponseWriter, r *http.Request, p server.Parameters) {
+	summary, err := Ctrl().GetReconciliation()
+	if err != nil {
+		failureResponse(w, "get reconciliation", err)
+		return
+	}
+	server.JsonResponse(w, &summary, http.StatusOK)
+}
+
+func ExportPins(w http.ResponseWriter, r *http.Request, p server.Parameters) {
+	filter, failure := parsePinFilter(r.URL.Query())
+	if failure != nil {
+		server.JsonResponse(w, failure, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	n, err := Ctrl().ExportPins(
+		w, filter.cids, filter.name,
+		filter.before, filter.after, filter.match,
+		filter.statuses, filter.meta,
+	)
+	if err != nil && n == 0 {
+		failureResponse(w, "export pins", err)
+		return
+	} else if err != nil {
+		// the response has already started; it ends with a record of
+		// the error
+		logger.Error(fmt.Sprintf(
+			"failed to export pins after %d record(s); %s",
+			n, err,
+		))
+	}
+}
+
+func ImportPins(w http.ResponseWriter, r *http.Request, p server.Parameters) {
+	query := r.URL.Query()
+	repin, failure := parseBoolParam(query, "repin")
+	if failure != nil {
+		server.JsonResponse(w, failure, http.StatusBadRequest)
+		return
+	}
+	overwrite, failure := parseBoolParam(query, "overwrite")
+	if failure != nil {
+		server.JsonResponse(w, failure, http.StatusBadRequest)
+		return
+	}
+	n, err := Ctrl().ImportPins(r.Body, repin, overwrite)
+	if err != nil {
+		failureResponse(
+			w, fmt.Sprintf("import pins after %d record(s)", n), err)
+		return
+	}
+	server.JsonResponse(w, &models.PinImport{Imported: n}, http.StatusOK)
+}
+
+func CreateApiKey(w http.ResponseWriter, r *http.Request, p server.Parameters) {
+	uid, ok := r.Context().Value(middleware.ClaimUserId).(string)
+	if !ok {
+		logger.Info("no user id")
+	}
+	grant, _ := r.Context().Value(middleware.ClaimGrant).(string)
+	if auth.IsApiKeyRequest(r) {
+		failureResponse(w, "create API key", ErrorApiKeyForbidden)
+		return
+	}
+	var data models.ApiKey
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil && err != io.EOF {
+		server.JsonResponse(w, models.NewFailure(
+			models.ErrFailedConversionCode,
+			fmt.Sprintf("failed to parse request body; %s", err),
+		), http.StatusBadRequest)
+		return
+	}
+	key, err := Ctrl().CreateApiKey(uid, grant, auth.RequestScopes(r), data.Name)
+	if err != nil {
+		failureResponse(w, "create API key", err)
+		return
+	}
+	server.JsonResponse(w, &key, http.StatusCreated)
+}
+
+func FindApiKeys(w http.ResponseWriter, r *http.Request, p server.Parameters) {
+	uid, ok := r.Context().Value(middleware.ClaimUserId).(string)
+	if !ok {
+		logger.Info("no user id")
+	}
+	keys, err := Ctrl().FindApiKeys(uid)
+	if err != nil {
+		failureResponse(w, "find API keys", err)
+		return
+	}
+	server.JsonResponse(w, &keys, http.StatusOK)
+}
+
+func RevokeApiKey(w http.ResponseWriter, r *http.Request, p server.Parameters) {
+	uid, ok := r.Context().Value(middleware.ClaimUserId).(string)
+	if !ok {
+		logger.Info("no user id")
+	}
+	id := p.Get("id")
+	if id == "" {
 		server.JsonResponse(w, models.NewFailure(
-			models.ErrProcessingRequestCode,
-			fmt.Sprintf("failed to remove pin; %s", err),
-		), http.StatusInternalServerError)
+			models.ErrRequiredParamCode,
+			"path parameter 'id' is required",
+		), http.StatusBadRequest)
+		return
+	}
+	if err := Ctrl().RevokeApiKey(uid, id); err != nil {
+		failureResponse(w, "revoke API key", err)
 		return
 	}
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// failureResponse writes the failure, and HTTP status, for the given error of
+// the given action. Errors of the controller and database are mapped to their
+// error codes; any other error is a failure to process the request.
+func failureResponse(w http.ResponseWriter, action string, err error) {
+	code := models.ErrProcessingRequestCode
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrorPinNotFound), errors.Is(err, pinsdb.ErrNotFound),
+		errors.Is(err, ErrorApiKeyNotFound):
+		code, status = models.ErrNotFoundCode, http.StatusNotFound
+	case errors.Is(err, ErrorInvalidUser):
+		code, status = models.ErrUnauthorizedCode, http.StatusUnauthorized
+	case errors.Is(err, ErrorApiKeyForbidden):
+		code, status = models.ErrForbiddenCode, http.StatusForbidden
+	case errors.Is(err, ErrorMaxNameLimit):
+		code, status = models.ErrMaxNameLimitCode, http.StatusBadRequest
+	case errors.Is(err, ErrorInvalidTimestamp),
+		errors.Is(err, ErrorInvalidPinRecord):
+		code, status = models.ErrFailedConversionCode, http.StatusBadRequest
+	case errors.Is(err, pinsdb.ErrInvalidCursor),
+		errors.Is(err, pinsdb.ErrCursorSorting):
+		code, status = models.ErrInvalidCursorCode, http.StatusBadRequest
+	case errors.Is(err, ErrorQuotaExceeded):
+		code, status = models.ErrInsufficientFundsCode, http.StatusConflict
+	case errors.Is(err, ErrorPinExists):
+		code, status = models.ErrConflictCode, http.StatusConflict
+	}
+	server.JsonResponse(w, models.NewFailure(
+		code, fmt.Sprintf("failed to %s; %s", action, err),
+	), status)
+}
+
+// parseBoolParam returns the boolean value of the given query parameter, or
+// false if it is not set. If the value is invalid, the failure describing it is
+// returned instead.
+func parseBoolParam(query url.Values, name string) (bool, *models.Failure) {
+	v := query.Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		failure := models.NewFailure(
+			models.ErrFailedConversionCode,
+			fmt.Sprintf("%s is not a boolean", name),
+		)
+		return false, &failure
+	}
+	return b, nil
+}
+
+// pinFilter represents the query parameters by which pins are filtered
+type pinFilter struct {
+	cids     []string
+	name     string
+	match    models.TextMatch
+	statuses []models.Status
+	before   string
+	after    string
+	meta     models.Info
+}
+
+// parsePinFilter returns the pin filter for the given query parameters. If a
+// parameter is invalid, the failure describing it is returned instead.
+func parsePinFilter(query url.Values) (pinFilter, *models.Failure) {
+	var err error
+	// get cid parameter(s)
+	cids, present := query["cid"]
+	if present {
+		if len(cids) > MaxPinLimit {
+			failure := models.NewFailure(
+				models.ErrMaxPinLimitCode,
+				fmt.Sprintf(
+					"max cid limit exceeded [1 .. %d]",
+					MaxPinLimit,
+				),
+			)
+			return pinFilter{}, &failure
+		}
+	}
+	// partial or fullmatch name of pins
+	name := query.Get("name")
+	if len(name) > MaxNameLimit {
+		failure := models.NewFailure(
+			models.ErrMaxNameLimitCode,
+			fmt.Sprintf(
+				"max name limit exceeded %d characters",
+				MaxNameLimit,
+			),
+		)
+		return pinFilter{}, &failure
+	}
+	// get text matching strategy
+	matchStr := query.Get("match")
+	match := models.TextMatchExact
+	if matchStr != "" {
+		match, err = models.ToTextMatch(matchStr)
+		if err != nil {
+			// unknown text matching
+			failure := models.NewFailure(
+				models.ErrUnknownTextMatchStringCode,
+				fmt.Sprintf("%s \"%s\"", err.Error(), matchStr),
+			)
+			return pinFilter{}, &failure
+		}
+	}
+	// get status parameter(s)
+	statuses := []models.Status{}
+	statusStrings, present := query["status"]
+	if present {
+		// create status map to remove duplicates, and append them to the status
+		// list
+		statusMap := make(map[models.Status]struct{})
+		for _, s := range statusStrings {
+			status, err := models.ToStatus(s)
+			if err != nil {
+				// unknown status
+				failure := models.NewFailure(
+					models.ErrUnknownStatusStringCode,
+					fmt.Sprintf("%s \"%s\"", err.Error(), s),
+				)
+				return pinFilter{}, &failure
+			}
+			statusMap[status] = struct{}{}
+		}
+		for s, _ := range statusMap {
+			statuses = append(statuses, s)
+		}
+	}
+	// get time range parameters
+	before := query.Get("before")
+	after := query.Get("after")
+	// get meta data parameter
+	meta := make(map[string]string)
+	if metaString := query.Get("meta"); metaString != "" {
+		if err := json.Unmarshal([]byte(metaString), &meta); err != nil {
+			failure := models.NewFailure(
+				models.ErrFailedConversionCode,
+				fmt.Sprintf("failed to parse meta data; %s", err),
+			)
+			return pinFilter{}, &failure
+		}
+	}
+	return pinFilter{
+		cids:     cids,
+		name:     name,
+		match:    match,
+		statuses: statuses,
+		before:   before,
+		after:    after,
+		meta:     meta,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pinsdb "github.com/crossedbot/axis/pkg/pins/database"
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+func TestFailureResponse(t *testing.T) {
+	tests := []struct {
+		Err    error
+		Reason string
+		Status int
+	}{
+		{ErrorPinNotFound, "NOT_FOUND", http.StatusNotFound},
+		{pinsdb.ErrNotFound, "NOT_FOUND", http.StatusNotFound},
+		{ErrorMaxNameLimit, "MAX_NAME_LIMIT", http.StatusBadRequest},
+		{
+			fmt.Errorf("%w for 'before' ('x')", ErrorInvalidTimestamp),
+			"FAILED_CONVERSION",
+			http.StatusBadRequest,
+		},
+		{
+			fmt.Errorf("%w (record 1): missing request ID",
+				ErrorInvalidPinRecord),
+			"FAILED_CONVERSION",
+			http.StatusBadRequest,
+		},
+		{pinsdb.ErrInvalidCursor, "INVALID_CURSOR", http.StatusBadRequest},
+		{pinsdb.ErrCursorSorting, "INVALID_CURSOR", http.StatusBadRequest},
+		{ErrorQuotaExceeded, "INSUFFICIENT_FUNDS", http.StatusConflict},
+		{
+			fmt.Errorf("%w (record 1): pin1", ErrorPinExists),
+			"CONFLICT",
+			http.StatusConflict,
+		},
+		{ErrorApiKeyNotFound, "NOT_FOUND", http.StatusNotFound},
+		{ErrorApiKeyForbidden, "FORBIDDEN", http.StatusForbidden},
+		{ErrorInvalidUser, "UNAUTHORIZED", http.StatusUnauthorized},
+		{
+			errors.New("connection refused"),
+			"PROCESSING_REQUEST",
+			http.StatusInternalServerError,
+		},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		failureResponse(w, "get pin", test.Err)
+		require.Equal(t, test.Status, w.Code, test.Err)
+		var failure models.Failure
+		require.Nil(t, json.Unmarshal(w.Body.Bytes(), &failure))
+		require.Equal(t, test.Reason, failure.Error.Reason)
+		require.Equal(
+			t,
+			fmt.Sprintf("failed to get pin; %s", test.Err),
+			failure.Error.Details,
+		)
+	}
+}
+
+func TestFindPinsLimit(t *testing.T) {
+	for _, limit := range []string{"0", "-1", "1001"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/pins?limit="+limit, nil)
+		FindPins(w, r, nil)
+		require.Equal(t, http.StatusBadRequest, w.Code, limit)
+		var failure models.Failure
+		require.Nil(t, json.Unmarshal(w.Body.Bytes(), &failure))
+		require.Equal(t, "MAX_PIN_LIMIT", failure.Error.Reason, limit)
+	}
+}
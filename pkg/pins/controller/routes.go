@@ -8,64 +8,127 @@ import (
 	"github.com/crossedbot/axis/pkg/auth"
 )
 
-// Route represents the route of the Pins HTTP API
+// Route represents the route of the Pins HTTP API. Every route is authorized;
+// the token of a request must hold each of the route's scopes.
 type Route struct {
 	Handler          server.Handler
 	Method           string
 	Path             string
+	Scopes           []string
 	ResponseSettings []server.ResponseSetting
 }
 
+// AuthorizedHandler returns the route's handler, authorizing requests for the
+// route's scopes.
+func (r Route) AuthorizedHandler() server.Handler {
+	return auth.Authorize(r.Handler, r.Scopes...)
+}
+
 // Routes is the list of routes of the Pins HTTP API
 var Routes = []Route{
 	// GetPin
 	Route{
-		auth.Authorize(GetPin),
+		GetPin,
 		http.MethodGet,
 		"/pins/:id",
+		[]string{auth.ScopePinsRead},
 		[]server.ResponseSetting{},
 	},
 	// FindPins
 	Route{
-		auth.Authorize(FindPins),
+		FindPins,
 		http.MethodGet,
 		"/pins",
+		[]string{auth.ScopePinsRead},
 		[]server.ResponseSetting{},
 	},
 	// CreatePin
 	Route{
-		auth.Authorize(CreatePin),
+		CreatePin,
 		http.MethodPost,
 		"/pins",
+		[]string{auth.ScopePinsWrite},
 		[]server.ResponseSetting{},
 	},
 	// UpdatePin
 	Route{
-		auth.Authorize(UpdatePin),
+		UpdatePin,
 		http.MethodPut,
 		"/pins/:id",
+		[]string{auth.ScopePinsWrite},
 		[]server.ResponseSetting{},
 	},
 	// UpdatePin (POST alternative)
 	Route{
-		auth.Authorize(UpdatePin),
+		UpdatePin,
 		// XXX POST for compatibility with existing pinning api specs
 		http.MethodPost,
 		"/pins/:id",
+		[]string{auth.ScopePinsWrite},
 		[]server.ResponseSetting{},
 	},
 	// PatchPin
 	Route{
-		auth.Authorize(PatchPin),
+		PatchPin,
 		http.MethodPatch,
 		"/pins/:id",
+		[]string{auth.ScopePinsWrite},
 		[]server.ResponseSetting{},
 	},
 	// RemovePin
 	Route{
-		auth.Authorize(RemovePin),
+		RemovePin,
 		http.MethodDelete,
 		"/pins/:id",
+		[]string{auth.ScopePinsDelete},
+		[]server.ResponseSetting{},
+	},
+	// GetReconciliation
+	Route{
+		GetReconciliation,
+		http.MethodGet,
+		"/reconciliation",
+		[]string{auth.ScopeAdmin},
+		[]server.ResponseSetting{},
+	},
+	// ExportPins
+	Route{
+		ExportPins,
+		http.MethodGet,
+		"/admin/pins/export",
+		[]string{auth.ScopeAdmin},
+		[]server.ResponseSetting{},
+	},
+	// ImportPins
+	Route{
+		ImportPins,
+		http.MethodPost,
+		"/admin/pins/import",
+		[]string{auth.ScopeAdmin},
+		[]server.ResponseSetting{},
+	},
+	// CreateApiKey
+	Route{
+		CreateApiKey,
+		http.MethodPost,
+		"/apikeys",
+		[]string{},
+		[]server.ResponseSetting{},
+	},
+	// FindApiKeys
+	Route{
+		FindApiKeys,
+		http.MethodGet,
+		"/apikeys",
+		[]string{},
+		[]server.ResponseSetting{},
+	},
+	// RevokeApiKey
+	Route{
+		RevokeApiKey,
+		http.MethodDelete,
+		"/apikeys/:id",
+		[]string{},
 		[]server.ResponseSetting{},
 	},
 }
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/crossedbot/common/golang/server"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crossedbot/axis/pkg/auth"
+)
+
+func TestRoutesAdminScope(t *testing.T) {
+	for _, route := range Routes {
+		if strings.HasPrefix(route.Path, "/admin/") ||
+			route.Path == "/reconciliation" {
+			require.Contains(t, route.Scopes, auth.ScopeAdmin,
+				"%s %s", route.Method, route.Path)
+		} else {
+			require.NotContains(t, route.Scopes, auth.ScopeAdmin,
+				"%s %s", route.Method, route.Path)
+		}
+	}
+}
+
+func TestRoutesAdminForbidden(t *testing.T) {
+	// the key of a user granted no scopes
+	auth.SetApiKeyFunc(func(string) (string, string, []string, error) {
+		return "myuserid", "user", nil, nil
+	})
+	defer auth.SetApiKeyFunc(func(string) (string, string, []string, error) {
+		return "", "", nil, auth.ErrInvalidApiKey
+	})
+	for _, route := range Routes {
+		if !strings.HasPrefix(route.Path, "/admin/") &&
+			route.Path != "/reconciliation" {
+			continue
+		}
+		r := httptest.NewRequest(route.Method, route.Path, nil)
+		r.Header.Set("Authorization", "Bearer "+auth.ApiKeyPrefix+"key")
+		rr := httptest.NewRecorder()
+		route.AuthorizedHandler()(rr, r, server.Parameters{})
+		require.Equal(t, http.StatusForbidden, rr.Code,
+			"%s %s", route.Method, route.Path)
+	}
+}
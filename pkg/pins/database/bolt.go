@@ -0,0 +1,366 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+var (
+	// Buckets
+	boltPinsBucket  = []byte("pins")  // pin ID -> pin
+	boltOwnerBucket = []byte("owner") // owner, pin ID -> nil
+	boltCidBucket   = []byte("cid")   // CID, pin ID -> nil
+
+	boltApiKeysBucket    = []byte("api_keys")     // API key ID -> API key
+	boltApiKeyHashBucket = []byte("api_key_hash") // hash -> API key ID
+)
+
+// boltRecord represents a Pin as stored in a bbolt database
+type boltRecord struct {
+	models.PinStatus
+	Owner string `json:"owner"`
+}
+
+// boltApiKeyRecord represents an API key as stored in a bbolt database
+type boltApiKeyRecord struct {
+	models.ApiKey
+	Hash  string `json:"hash"`
+	Owner string `json:"owner"`
+	Grant string `json:"grant"`
+}
+
+// boltPins represents a bbolt implementation of the Pins interface
+type boltPins struct {
+	*bolt.DB
+}
+
+// NewBolt returns a new Pins stored in the bbolt database file at the given
+// path; the file is created if it does not exist. Writes are synced to disk
+// before they return. If drop is set, the data is dropped from the database.
+func NewBolt(path string, drop bool) (Pins, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	buckets := [][]byte{
+		boltPinsBucket, boltOwnerBucket, boltCidBucket,
+		boltApiKeysBucket, boltApiKeyHashBucket,
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range buckets {
+			if drop && tx.Bucket(name) != nil {
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltPins{DB: db}, nil
+}
+
+func (d *boltPins) Set(pinStatus models.PinStatus) error {
+	created, err := parseCreated(pinStatus.Created)
+	if err != nil {
+		return err
+	}
+	pinStatus.Created = formatCreated(created)
+	return d.Update(func(tx *bolt.Tx) error {
+		return boltPut(tx, copyPinStatus(pinStatus))
+	})
+}
+
+func (d *boltPins) Patch(id string, fields map[string]interface{}) error {
+	return d.Update(func(tx *bolt.Tx) error {
+		ps, err := boltGet(tx, id)
+		if err != nil {
+			return err
+		}
+		patchPinStatus(&ps, fields)
+		return boltPut(tx, ps)
+	})
+}
+
+func (d *boltPins) Get(id string) (models.PinStatus, error) {
+	var ps models.PinStatus
+	err := d.View(func(tx *bolt.Tx) error {
+		var err error
+		ps, err = boltGet(tx, id)
+		return err
+	})
+	return ps, err
+}
+
+func (d *boltPins) Find(
+	owner string,
+	cids, statuses []string,
+	name string,
+	before, after int64,
+	match string,
+	limit int, offset int,
+	cursor *Cursor,
+	sortBy *SortingKey,
+	meta models.Info,
+) (models.Pins, error) {
+	if owner == "" {
+		return models.Pins{}, ErrMissingOwner
+	}
+	sortBy, err := cursorSorting(cursor, sortBy)
+	if err != nil {
+		return models.Pins{}, err
+	}
+	filter := newPinFilter(
+		owner, cids, statuses, name, before, after, match, cursor,
+		sortBy, meta,
+	)
+	matches := []models.PinStatus{}
+	err = d.View(func(tx *bolt.Tx) error {
+		collect := func(ps models.PinStatus) {
+			if filter.matches(ps) {
+				matches = append(matches, ps)
+			}
+		}
+		if owner == AllOwners {
+			// scan every pin
+			return tx.Bucket(boltPinsBucket).ForEach(func(_, v []byte) error {
+				ps, err := boltDecode(v)
+				if err != nil {
+					return err
+				}
+				collect(ps)
+				return nil
+			})
+		}
+		// scan the pins of the owner
+		c := tx.Bucket(boltOwnerBucket).Cursor()
+		prefix := boltIndexPrefix(owner)
+		for k, _ := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			ps, err := boltGet(tx, string(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			collect(ps)
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Pins{}, err
+	}
+	return pagePins(matches, limit, offset, sortBy)
+}
+
+func (d *boltPins) Delete(id string) error {
+	return d.Update(func(tx *bolt.Tx) error {
+		ps, err := boltGet(tx, id)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return boltDelete(tx, ps)
+	})
+}
+
+func (d *boltPins) References(cid string) (int, error) {
+	refs := 0
+	err := d.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltCidBucket).Cursor()
+		prefix := boltIndexPrefix(cid)
+		for k, _ := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			refs++
+		}
+		return nil
+	})
+	return refs, err
+}
+
+func (d *boltPins) SetApiKey(key models.ApiKey) error {
+	key, err := normalizeApiKey(key)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(boltApiKeyRecord{
+		ApiKey: key,
+		Hash:   key.Hash,
+		Owner:  key.Owner,
+		Grant:  key.Grant,
+	})
+	if err != nil {
+		return err
+	}
+	return d.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(boltApiKeysBucket)
+		hashes := tx.Bucket(boltApiKeyHashBucket)
+		if v := keys.Get([]byte(key.Id)); v != nil {
+			prev, err := boltDecodeApiKey(v)
+			if err != nil {
+				return err
+			}
+			if err := hashes.Delete([]byte(prev.Hash)); err != nil {
+				return err
+			}
+		}
+		if err := keys.Put([]byte(key.Id), b); err != nil {
+			return err
+		}
+		return hashes.Put([]byte(key.Hash), []byte(key.Id))
+	})
+}
+
+func (d *boltPins) GetApiKey(hash string) (models.ApiKey, error) {
+	var key models.ApiKey
+	err := d.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(boltApiKeyHashBucket).Get([]byte(hash))
+		if id == nil {
+			return ErrApiKeyNotFound
+		}
+		v := tx.Bucket(boltApiKeysBucket).Get(id)
+		if v == nil {
+			return ErrApiKeyNotFound
+		}
+		var err error
+		key, err = boltDecodeApiKey(v)
+		return err
+	})
+	return key, err
+}
+
+func (d *boltPins) FindApiKeys(owner string) ([]models.ApiKey, error) {
+	keys := []models.ApiKey{}
+	err := d.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltApiKeysBucket).ForEach(func(_, v []byte) error {
+			key, err := boltDecodeApiKey(v)
+			if err != nil {
+				return err
+			}
+			if key.Owner == owner {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortApiKeys(keys)
+	return keys, nil
+}
+
+func (d *boltPins) DeleteApiKey(owner, id string) error {
+	return d.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(boltApiKeysBucket)
+		v := keys.Get([]byte(id))
+		if v == nil {
+			return ErrApiKeyNotFound
+		}
+		key, err := boltDecodeApiKey(v)
+		if err != nil {
+			return err
+		}
+		if key.Owner != owner {
+			return ErrApiKeyNotFound
+		}
+		err = tx.Bucket(boltApiKeyHashBucket).Delete([]byte(key.Hash))
+		if err != nil {
+			return err
+		}
+		return keys.Delete([]byte(id))
+	})
+}
+
+// boltGet returns the Pin for the given ID.
+func boltGet(tx *bolt.Tx, id string) (models.PinStatus, error) {
+	v := tx.Bucket(boltPinsBucket).Get([]byte(id))
+	if v == nil {
+		return models.PinStatus{}, ErrNotFound
+	}
+	return boltDecode(v)
+}
+
+// boltPut stores the given Pin, replacing the index entries of any previous
+// version of the Pin.
+func boltPut(tx *bolt.Tx, ps models.PinStatus) error {
+	prev, err := boltGet(tx, ps.Id)
+	if err == nil {
+		if err := boltDelete(tx, prev); err != nil {
+			return err
+		}
+	} else if err != ErrNotFound {
+		return err
+	}
+	b, err := json.Marshal(boltRecord{PinStatus: ps, Owner: ps.Owner})
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltPinsBucket).Put([]byte(ps.Id), b); err != nil {
+		return err
+	}
+	err = tx.Bucket(boltOwnerBucket).Put(boltIndexKey(ps.Owner, ps.Id), nil)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltCidBucket).Put(boltIndexKey(ps.Pin.Cid, ps.Id), nil)
+}
+
+// boltDelete removes the given Pin and its index entries.
+func boltDelete(tx *bolt.Tx, ps models.PinStatus) error {
+	err := tx.Bucket(boltOwnerBucket).Delete(boltIndexKey(ps.Owner, ps.Id))
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(boltCidBucket).Delete(boltIndexKey(ps.Pin.Cid, ps.Id))
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltPinsBucket).Delete([]byte(ps.Id))
+}
+
+// boltDecode returns the Pin decoded from the given stored value.
+func boltDecode(v []byte) (models.PinStatus, error) {
+	var rec boltRecord
+	if err := json.Unmarshal(v, &rec); err != nil {
+		return models.PinStatus{}, err
+	}
+	rec.PinStatus.Owner = rec.Owner
+	// pins stored prior to RFC 3339 timestamps were created in Unix seconds
+	if created, err := parseCreated(rec.Created); err == nil {
+		rec.Created = formatCreated(created)
+	}
+	return copyPinStatus(rec.PinStatus), nil
+}
+
+// boltDecodeApiKey returns the API key decoded from the given stored value.
+func boltDecodeApiKey(v []byte) (models.ApiKey, error) {
+	var rec boltApiKeyRecord
+	if err := json.Unmarshal(v, &rec); err != nil {
+		return models.ApiKey{}, err
+	}
+	key := rec.ApiKey
+	key.Hash = rec.Hash
+	key.Owner = rec.Owner
+	key.Grant = rec.Grant
+	return key, nil
+}
+
+// boltIndexPrefix returns the prefix of the index keys for the given value.
+// Values are terminated by a zero byte, so that no value prefixes another.
+func boltIndexPrefix(val string) []byte {
+	return append([]byte(val), 0)
+}
+
+// boltIndexKey returns the index key of the given value and pin ID.
+func boltIndexKey(val, id string) []byte {
+	return append(boltIndexPrefix(val), id...)
+}
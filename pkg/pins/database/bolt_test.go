@@ -0,0 +1,41 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+func TestBoltReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pins.db")
+	ps := models.PinStatus{
+		Id:      "pin1",
+		Status:  "queued",
+		Created: "1621000000",
+		Pin:     models.Pin{Cid: "abc123", Name: "helloworld"},
+		Owner:   "alice",
+	}
+	db, err := NewBolt(path, false)
+	require.Nil(t, err)
+	require.Nil(t, db.Set(ps))
+	require.Nil(t, db.(*boltPins).Close())
+	// the pins and their indexes are persisted
+	db, err = NewBolt(path, false)
+	require.Nil(t, err)
+	pins, err := db.Find("alice", nil, nil, "", 0, 0, "", 0, 0, nil, nil, nil)
+	require.Nil(t, err)
+	require.Equal(t, 1, pins.Total)
+	refs, err := db.References(ps.Pin.Cid)
+	require.Nil(t, err)
+	require.Equal(t, 1, refs)
+	require.Nil(t, db.(*boltPins).Close())
+	// the pins are dropped
+	db, err = NewBolt(path, true)
+	require.Nil(t, err)
+	defer db.(*boltPins).Close()
+	_, err = db.Get(ps.Id)
+	require.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,53 @@
+package database_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pinsdb "github.com/crossedbot/axis/pkg/pins/database"
+	"github.com/crossedbot/axis/pkg/pins/database/databasetest"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	databasetest.TestPins(t, pinsdb.DriverMemory, func(t *testing.T) pinsdb.Pins {
+		return pinsdb.NewMemory()
+	})
+}
+
+func TestBoltConformance(t *testing.T) {
+	databasetest.TestPins(t, pinsdb.DriverBolt, func(t *testing.T) pinsdb.Pins {
+		path := filepath.Join(t.TempDir(), "pins.db")
+		db, err := pinsdb.NewBolt(path, false)
+		require.Nil(t, err)
+		t.Cleanup(func() { db.(interface{ Close() error }).Close() })
+		return db
+	})
+}
+
+func TestRedisConformance(t *testing.T) {
+	addr := os.Getenv(pinsdb.RedisAddrEnv)
+	if addr == "" {
+		t.Skipf("%s is not set", pinsdb.RedisAddrEnv)
+	}
+	databasetest.TestPins(t, pinsdb.DriverRedis, func(t *testing.T) pinsdb.Pins {
+		db, err := pinsdb.New(context.Background(), addr, true)
+		require.Nil(t, err)
+		return db
+	})
+}
+
+func TestPostgresConformance(t *testing.T) {
+	dsn := os.Getenv(pinsdb.PostgresDsnEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", pinsdb.PostgresDsnEnv)
+	}
+	databasetest.TestPins(t, pinsdb.DriverPostgres, func(t *testing.T) pinsdb.Pins {
+		db, err := pinsdb.NewPostgres(context.Background(), dsn, true)
+		require.Nil(t, err)
+		return db
+	})
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+var (
+	// Cursor errors
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrCursorSorting = errors.New("cursor requires sorting by 'created'")
+)
+
+// Cursor represents the position of a Pin in the results of a Find sorted by
+// creation. Pins created at the same time are ordered by their IDs, in the same
+// direction, such that the position of every Pin is unique and stable while
+// Pins are added or removed. A Find given a cursor returns the Pins that follow
+// it.
+type Cursor struct {
+	Created int64 // in Unix milliseconds
+	Id      string
+}
+
+// NewCursor returns the Cursor at the position of the given Pin.
+func NewCursor(ps models.PinStatus) (Cursor, error) {
+	created, err := parseCreated(ps.Created)
+	if err != nil {
+		return Cursor{}, err
+	}
+	return Cursor{Created: created, Id: ps.Id}, nil
+}
+
+// ParseCursor returns the Cursor for the given string, as encoded by
+// Cursor.String.
+func ParseCursor(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+	created, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{Created: created, Id: parts[1]}, nil
+}
+
+// String returns the cursor as an opaque, URL safe, string.
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("%d:%s", c.Created, c.Id)))
+}
+
+// Follows returns true if a Pin created at the given time, and of the given ID,
+// follows the cursor in the given sorting direction.
+func (c Cursor) Follows(created int64, id string, ascending bool) bool {
+	if created != c.Created {
+		return (created > c.Created) == ascending
+	}
+	if id == c.Id {
+		return false
+	}
+	return (id > c.Id) == ascending
+}
+
+// cursorSorting returns the sorting key of a Find given the cursor. Results
+// are sorted by creation, in ascending order unless set otherwise, if a cursor
+// is given.
+func cursorSorting(cursor *Cursor, sortBy *SortingKey) (*SortingKey, error) {
+	if cursor == nil {
+		return sortBy, nil
+	}
+	if sortBy == nil {
+		return &SortingKey{Field: "created", Ascending: true}, nil
+	}
+	if sortBy.Field != "created" {
+		return nil, ErrCursorSorting
+	}
+	return sortBy, nil
+}
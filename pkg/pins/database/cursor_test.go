@@ -0,0 +1,64 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+func TestCursorString(t *testing.T) {
+	cursor, err := NewCursor(models.PinStatus{
+		Id:      "0b6e0c8e-8f2a-4bde-9e3a-0d8f0c7e2a11",
+		Created: "1621000000",
+	})
+	require.Nil(t, err)
+	actual, err := ParseCursor(cursor.String())
+	require.Nil(t, err)
+	require.Equal(t, cursor, actual)
+	for _, s := range []string{"", "!", "MTYyMTAwMDAwMA", "YTpwaW4x", "MTYyMTAwMDAwMDo"} {
+		_, err = ParseCursor(s)
+		require.Equal(t, ErrInvalidCursor, err, s)
+	}
+	_, err = NewCursor(models.PinStatus{Id: "pin1", Created: "x"})
+	require.NotNil(t, err)
+}
+
+func TestCursorFollows(t *testing.T) {
+	cursor := Cursor{Created: 1621000001, Id: "pin2"}
+	tests := []struct {
+		Created   int64
+		Id        string
+		Ascending bool
+		Expected  bool
+	}{
+		{1621000002, "pin1", true, true},
+		{1621000000, "pin3", true, false},
+		{1621000001, "pin3", true, true},
+		{1621000001, "pin1", true, false},
+		{1621000001, "pin2", true, false},
+		{1621000002, "pin1", false, false},
+		{1621000000, "pin3", false, true},
+		{1621000001, "pin3", false, false},
+		{1621000001, "pin1", false, true},
+		{1621000001, "pin2", false, false},
+	}
+	for _, test := range tests {
+		actual := cursor.Follows(test.Created, test.Id, test.Ascending)
+		require.Equal(t, test.Expected, actual, "%+v", test)
+	}
+}
+
+func TestCursorSorting(t *testing.T) {
+	sortBy := &SortingKey{Field: "name", Ascending: true}
+	actual, err := cursorSorting(nil, sortBy)
+	require.Nil(t, err)
+	require.Equal(t, sortBy, actual)
+	cursor := &Cursor{Created: 1621000000, Id: "pin1"}
+	actual, err = cursorSorting(cursor, nil)
+	require.Nil(t, err)
+	require.Equal(t, &SortingKey{Field: "created", Ascending: true}, actual)
+	_, err = cursorSorting(cursor, sortBy)
+	require.Equal(t, ErrCursorSorting, err)
+}
@@ -0,0 +1,533 @@
+// Package databasetest provides a conformance test suite for implementations
+// of the pins database.
+package databasetest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pinsdb "github.com/crossedbot/axis/pkg/pins/database"
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+const (
+	// CidA is the CID shared by the first and third test pins
+	CidA = "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv"
+	// CidB is the CID of the second test pin
+	CidB = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+)
+
+// PinStatuses returns the pins stored in the database before each test. Names
+// and meta values include punctuation, commas, and colons.
+func PinStatuses() []models.PinStatus {
+	return []models.PinStatus{
+		{
+			Id:      "pin1",
+			Status:  "pinned",
+			Created: "2021-05-14T13:46:41.000Z",
+			Pin: models.Pin{
+				Cid:     CidA,
+				Name:    "Hello, World! (v1.0)",
+				Origins: []string{"/ip4/127.0.0.1/tcp/4001"},
+				Meta: models.Info{
+					"app": "one",
+					"url": "https://example.com/a,b",
+				},
+			},
+			Delegates: []string{"/ip4/127.0.0.1/tcp/4002"},
+			Info:      models.Info{"status_details": "a, b: c"},
+			Owner:     "alice",
+		},
+		{
+			Id:      "pin2",
+			Status:  "queued",
+			Created: "2021-05-14T13:46:41.500Z",
+			Pin: models.Pin{
+				Cid:  CidB,
+				Name: "hello world",
+				Meta: models.Info{"app": "two", "env": "prod"},
+			},
+			Owner: "alice",
+		},
+		{
+			Id:      "pin3",
+			Status:  "failed",
+			Created: "2021-05-14T13:46:42.000Z",
+			Pin: models.Pin{
+				Cid:  CidA,
+				Name: "goodbye",
+				Meta: models.Info{"env": "prod", "time": "12:30"},
+			},
+			Owner: "bob",
+		},
+	}
+}
+
+// Query represents the parameters of a Find, and the IDs of the pins it is
+// expected to return.
+type Query struct {
+	Owner    string // defaults to pinsdb.AllOwners
+	Cids     []string
+	Statuses []string
+	Name     string
+	Before   int64
+	After    int64
+	Match    string
+	Limit    int
+	Offset   int
+	Cursor   *pinsdb.Cursor
+	SortBy   *pinsdb.SortingKey
+	Meta     models.Info
+	Expected []string
+	Total    int  // defaults to the number of expected pins
+	NoRedis  bool // RediSearch matches partial names case-insensitively
+}
+
+var createdAsc = &pinsdb.SortingKey{Field: "created", Ascending: true}
+
+// Queries is the list of Find queries, over the test pins, run by the suite
+var Queries = []Query{
+	{SortBy: createdAsc, Expected: []string{"pin1", "pin2", "pin3"}},
+	{Owner: "alice", SortBy: createdAsc, Expected: []string{"pin1", "pin2"}},
+	{Owner: "carol", Expected: []string{}},
+	{Cids: []string{CidA}, SortBy: createdAsc, Expected: []string{"pin1", "pin3"}},
+	{
+		Cids:     []string{CidA, CidB},
+		SortBy:   createdAsc,
+		Expected: []string{"pin1", "pin2", "pin3"},
+	},
+	{
+		Statuses: []string{"queued", "failed"},
+		SortBy:   createdAsc,
+		Expected: []string{"pin2", "pin3"},
+	},
+	{
+		Owner:    "alice",
+		Statuses: []string{"pinned"},
+		Expected: []string{"pin1"},
+	},
+	{Name: "Hello, World! (v1.0)", Match: "exact", Expected: []string{"pin1"}},
+	{Name: "hello, world! (v1.0)", Match: "exact", Expected: []string{}},
+	{Name: "HELLO WORLD", Match: "iexact", Expected: []string{"pin2"}},
+	{
+		Name:     "World",
+		Match:    "partial",
+		Expected: []string{"pin1"},
+		NoRedis:  true,
+	},
+	{
+		Name:     "(v1.0)",
+		Match:    "partial",
+		Expected: []string{"pin1"},
+		NoRedis:  true,
+	},
+	{
+		Name:     "WORLD",
+		Match:    "ipartial",
+		SortBy:   createdAsc,
+		Expected: []string{"pin1", "pin2"},
+	},
+	{Before: 1621000001500, Expected: []string{"pin1"}},
+	{After: 1621000001500, Expected: []string{"pin3"}},
+	{
+		Before:   1621000002000,
+		After:    1621000001000,
+		Expected: []string{"pin2"},
+	},
+	{
+		Meta:     models.Info{"env": "prod"},
+		SortBy:   createdAsc,
+		Expected: []string{"pin2", "pin3"},
+	},
+	{Meta: models.Info{"env": "prod", "app": "two"}, Expected: []string{"pin2"}},
+	{
+		Meta:     models.Info{"url": "https://example.com/a,b"},
+		Expected: []string{"pin1"},
+	},
+	{Meta: models.Info{"time": "12:30"}, Expected: []string{"pin3"}},
+	{Meta: models.Info{"app": "three"}, Expected: []string{}},
+	{
+		SortBy:   &pinsdb.SortingKey{Field: "created", Ascending: false},
+		Expected: []string{"pin3", "pin2", "pin1"},
+	},
+	{
+		Limit:    1,
+		Offset:   1,
+		SortBy:   createdAsc,
+		Expected: []string{"pin2"},
+		Total:    3,
+	},
+	{Limit: 2, Offset: 5, SortBy: createdAsc, Expected: []string{}, Total: 3},
+	{
+		Offset:   1,
+		SortBy:   createdAsc,
+		Expected: []string{"pin2", "pin3"},
+		Total:    3,
+	},
+	{
+		Cursor:   &pinsdb.Cursor{Created: 1621000001000, Id: "pin1"},
+		Expected: []string{"pin2", "pin3"},
+		SortBy:   createdAsc,
+	},
+	{
+		Owner:    "alice",
+		Cursor:   &pinsdb.Cursor{Created: 1621000001000, Id: "pin1"},
+		SortBy:   createdAsc,
+		Expected: []string{"pin2"},
+	},
+	{
+		Limit:    1,
+		Cursor:   &pinsdb.Cursor{Created: 1621000001000, Id: "pin1"},
+		SortBy:   createdAsc,
+		Expected: []string{"pin2"},
+		Total:    2,
+	},
+	{
+		Cursor:   &pinsdb.Cursor{Created: 1621000001500, Id: "pin2"},
+		SortBy:   &pinsdb.SortingKey{Field: "created", Ascending: false},
+		Expected: []string{"pin1"},
+	},
+	{
+		Cursor:   &pinsdb.Cursor{Created: 1621000002000, Id: "pin3"},
+		SortBy:   createdAsc,
+		Expected: []string{},
+	},
+}
+
+// TestPins runs the conformance suite against the Pins, of the given driver,
+// returned by newPins. A new, empty database is expected for every call.
+func TestPins(
+	t *testing.T,
+	driver string,
+	newPins func(t *testing.T) pinsdb.Pins,
+) {
+	tests := []struct {
+		Name string
+		Test func(t *testing.T, db pinsdb.Pins)
+	}{
+		{"SetGet", testSetGet},
+		{"SetReplace", testSetReplace},
+		{"Patch", testPatch},
+		{"Find", func(t *testing.T, db pinsdb.Pins) {
+			testFind(t, db, driver)
+		}},
+		{"FindCursor", testFindCursor},
+		{"FindDefaultLimit", testFindDefaultLimit},
+		{"DeleteReferences", testDeleteReferences},
+		{"ApiKeys", testApiKeys},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			db := newPins(t)
+			for _, ps := range PinStatuses() {
+				require.Nil(t, db.Set(ps))
+			}
+			test.Test(t, db)
+		})
+	}
+}
+
+// Find returns the pins found for the given query.
+func Find(t *testing.T, db pinsdb.Pins, q Query) models.Pins {
+	owner := q.Owner
+	if owner == "" {
+		owner = pinsdb.AllOwners
+	}
+	pins, err := db.Find(
+		owner, q.Cids, q.Statuses, q.Name, q.Before, q.After,
+		q.Match, q.Limit, q.Offset, q.Cursor, q.SortBy, q.Meta,
+	)
+	require.Nil(t, err)
+	return pins
+}
+
+// Ids returns the IDs of the given pins.
+func Ids(t *testing.T, pins models.Pins) []string {
+	ids := []string{}
+	for _, ps := range pins.Results {
+		ids = append(ids, ps.Id)
+	}
+	require.Equal(t, len(ids), pins.Count)
+	return ids
+}
+
+// normalize returns the given pin as returned by the database; unset lists and
+// maps are empty.
+func normalize(ps models.PinStatus) models.PinStatus {
+	if ps.Pin.Origins == nil {
+		ps.Pin.Origins = []string{}
+	}
+	if ps.Pin.Meta == nil {
+		ps.Pin.Meta = models.Info{}
+	}
+	if ps.Delegates == nil {
+		ps.Delegates = []string{}
+	}
+	if ps.Info == nil {
+		ps.Info = models.Info{}
+	}
+	return ps
+}
+
+func testSetGet(t *testing.T, db pinsdb.Pins) {
+	for _, ps := range PinStatuses() {
+		actual, err := db.Get(ps.Id)
+		require.Nil(t, err)
+		require.Equal(t, normalize(ps), actual)
+	}
+	_, err := db.Get("missing")
+	require.Equal(t, pinsdb.ErrNotFound, err)
+	require.NotNil(t, db.Set(models.PinStatus{Id: "bad", Created: "x"}))
+	// Unix timestamps are stored as RFC 3339 timestamps
+	ps := PinStatuses()[0]
+	ps.Id = "unix"
+	ps.Created = "1621000000"
+	require.Nil(t, db.Set(ps))
+	actual, err := db.Get(ps.Id)
+	require.Nil(t, err)
+	require.Equal(t, "2021-05-14T13:46:40.000Z", actual.Created)
+}
+
+func testSetReplace(t *testing.T, db pinsdb.Pins) {
+	ps := PinStatuses()[0]
+	ps.Status = "failed"
+	ps.Pin.Cid = CidB
+	ps.Pin.Name = "renamed"
+	require.Nil(t, db.Set(ps))
+	actual, err := db.Get(ps.Id)
+	require.Nil(t, err)
+	require.Equal(t, normalize(ps), actual)
+	refs, err := db.References(CidA)
+	require.Nil(t, err)
+	require.Equal(t, 1, refs)
+	pins := Find(t, db, Query{Name: "renamed", Match: "exact"})
+	require.Equal(t, []string{ps.Id}, Ids(t, pins))
+	pins = Find(t, db, Query{})
+	require.Equal(t, len(PinStatuses()), pins.Total)
+}
+
+func testPatch(t *testing.T, db pinsdb.Pins) {
+	ps := PinStatuses()[1]
+	ps.Status = "pinned"
+	ps.Pin.Cid = CidA
+	ps.Pin.Name = "Goodbye, World: [v2]"
+	ps.Pin.Origins = []string{"/ip4/127.0.0.1/tcp/4001"}
+	ps.Pin.Meta = models.Info{"app": "two", "url": "https://example.com/?a=b,c"}
+	ps.Info = models.Info{
+		"status_details": "a, b: c",
+		"last_check":     "2021-05-14T13:46:40.000Z",
+	}
+	err := db.Patch(ps.Id, map[string]interface{}{
+		"status":  ps.Status,
+		"cid":     ps.Pin.Cid,
+		"name":    ps.Pin.Name,
+		"origins": ps.Pin.Origins,
+		"meta":    ps.Pin.Meta,
+		"info":    ps.Info,
+	})
+	require.Nil(t, err)
+	actual, err := db.Get(ps.Id)
+	require.Nil(t, err)
+	require.Equal(t, normalize(ps), actual)
+	// the patched fields are searchable
+	pins := Find(t, db, Query{
+		Cids:     []string{CidA},
+		Statuses: []string{"pinned"},
+		Name:     ps.Pin.Name,
+		Match:    "exact",
+		Meta:     models.Info{"url": "https://example.com/?a=b,c"},
+	})
+	require.Equal(t, []string{ps.Id}, Ids(t, pins))
+	refs, err := db.References(CidB)
+	require.Nil(t, err)
+	require.Equal(t, 0, refs)
+	require.Equal(t, pinsdb.ErrNotFound, db.Patch("missing", map[string]interface{}{
+		"status": "pinned",
+	}))
+}
+
+func testFind(t *testing.T, db pinsdb.Pins, driver string) {
+	for i, q := range Queries {
+		if q.NoRedis && driver == pinsdb.DriverRedis {
+			continue
+		}
+		msg := fmt.Sprintf("query %d: %+v", i, q)
+		pins := Find(t, db, q)
+		if q.SortBy != nil {
+			require.Equal(t, q.Expected, Ids(t, pins), msg)
+		} else {
+			require.ElementsMatch(t, q.Expected, Ids(t, pins), msg)
+		}
+		total := q.Total
+		if total == 0 {
+			total = len(q.Expected)
+		}
+		require.Equal(t, total, pins.Total, msg)
+	}
+	// an empty owner never matches every owner
+	_, err := db.Find("", nil, nil, "", 0, 0, "", 0, 0, nil, nil, nil)
+	require.Equal(t, pinsdb.ErrMissingOwner, err)
+}
+
+func testFindCursor(t *testing.T, db pinsdb.Pins) {
+	// pins created at the same time are ordered by ID
+	for _, id := range []string{"pin5", "pin4"} {
+		ps := PinStatuses()[1]
+		ps.Id = id
+		require.Nil(t, db.Set(ps))
+	}
+	for _, ascending := range []bool{true, false} {
+		expected := []string{"pin1", "pin2", "pin4", "pin5", "pin3"}
+		if !ascending {
+			expected = []string{"pin3", "pin5", "pin4", "pin2", "pin1"}
+		}
+		sortBy := &pinsdb.SortingKey{Field: "created", Ascending: ascending}
+		ids := []string{}
+		var cursor *pinsdb.Cursor
+		for len(ids) < len(expected) {
+			pins := Find(t, db, Query{
+				Limit:  2,
+				Cursor: cursor,
+				SortBy: sortBy,
+			})
+			require.Equal(t, len(expected)-len(ids), pins.Total)
+			require.NotEmpty(t, pins.Results)
+			ids = append(ids, Ids(t, pins)...)
+			next, err := pinsdb.NewCursor(
+				pins.Results[len(pins.Results)-1])
+			require.Nil(t, err)
+			cursor = &next
+		}
+		require.Equal(t, expected, ids)
+		pins := Find(t, db, Query{Cursor: cursor, SortBy: sortBy})
+		require.Empty(t, pins.Results)
+		// pins added before the cursor are not returned
+		ps := PinStatuses()[0]
+		ps.Id = "pin0"
+		ps.Created = "2021-05-14T13:46:40.000Z"
+		if !ascending {
+			ps.Created = "2021-05-14T13:46:43.000Z"
+		}
+		require.Nil(t, db.Set(ps))
+		pins = Find(t, db, Query{
+			Cursor: &pinsdb.Cursor{Created: 1621000001500, Id: "pin2"},
+			SortBy: sortBy,
+		})
+		if ascending {
+			require.Equal(t, []string{"pin4", "pin5", "pin3"}, Ids(t, pins))
+		} else {
+			require.Equal(t, []string{"pin1"}, Ids(t, pins))
+		}
+		require.Nil(t, db.Delete(ps.Id))
+	}
+	// a cursor requires sorting by creation
+	_, err := db.Find(pinsdb.AllOwners, nil, nil, "", 0, 0, "", 0, 0,
+		&pinsdb.Cursor{Created: 1621000001000, Id: "pin1"},
+		&pinsdb.SortingKey{Field: "name", Ascending: true}, nil)
+	require.Equal(t, pinsdb.ErrCursorSorting, err)
+}
+
+func testFindDefaultLimit(t *testing.T, db pinsdb.Pins) {
+	for i := 0; i < pinsdb.DefaultLimit; i++ {
+		ps := PinStatuses()[2]
+		ps.Id = fmt.Sprintf("pin%d", i+4)
+		require.Nil(t, db.Set(ps))
+	}
+	total := len(PinStatuses()) + pinsdb.DefaultLimit
+	for _, limit := range []int{0, -1} {
+		pins := Find(t, db, Query{Limit: limit})
+		require.Equal(t, pinsdb.DefaultLimit, pins.Count)
+		require.Equal(t, total, pins.Total)
+	}
+}
+
+func testDeleteReferences(t *testing.T, db pinsdb.Pins) {
+	refs, err := db.References(CidA)
+	require.Nil(t, err)
+	require.Equal(t, 2, refs)
+	require.Nil(t, db.Delete("pin1"))
+	_, err = db.Get("pin1")
+	require.Equal(t, pinsdb.ErrNotFound, err)
+	refs, err = db.References(CidA)
+	require.Nil(t, err)
+	require.Equal(t, 1, refs)
+	pins := Find(t, db, Query{Owner: "alice"})
+	require.Equal(t, []string{"pin2"}, Ids(t, pins))
+	refs, err = db.References("QmUnknown")
+	require.Nil(t, err)
+	require.Equal(t, 0, refs)
+}
+
+func testApiKeys(t *testing.T, db pinsdb.Pins) {
+	keys := []models.ApiKey{
+		{
+			Id:      "key2",
+			Name:    "deploy, prod",
+			Prefix:  "axis_bbbbbb",
+			Created: "2021-05-14T13:46:42.000Z",
+			Hash:    "hash2",
+			Owner:   "alice",
+			Grant:   "user",
+		},
+		{
+			Id:      "key1",
+			Name:    "ci",
+			Prefix:  "axis_aaaaaa",
+			Created: "2021-05-14T13:46:41.000Z",
+			Key:     "axis_aaaaaaplain",
+			Scopes:  []string{"pins:read", "pins:write"},
+			Hash:    "hash1",
+			Owner:   "alice",
+			Grant:   "user",
+		},
+		{
+			Id:      "key3",
+			Prefix:  "axis_cccccc",
+			Created: "1621000000",
+			Hash:    "hash3",
+			Owner:   "bob",
+		},
+	}
+	for _, key := range keys {
+		require.Nil(t, db.SetApiKey(key))
+	}
+	// plain keys are never stored, and times are RFC 3339 timestamps
+	expected := keys[1]
+	expected.Key = ""
+	actual, err := db.GetApiKey("hash1")
+	require.Nil(t, err)
+	require.Equal(t, expected, actual)
+	actual, err = db.GetApiKey("hash3")
+	require.Nil(t, err)
+	require.Equal(t, "2021-05-14T13:46:40.000Z", actual.Created)
+	require.Nil(t, actual.Scopes)
+	_, err = db.GetApiKey("missing")
+	require.Equal(t, pinsdb.ErrApiKeyNotFound, err)
+	found, err := db.FindApiKeys("alice")
+	require.Nil(t, err)
+	require.Equal(t, []models.ApiKey{expected, keys[0]}, found)
+	found, err = db.FindApiKeys("carol")
+	require.Nil(t, err)
+	require.Empty(t, found)
+	// replacing a key replaces its hash
+	rotated := keys[0]
+	rotated.Hash = "hash2b"
+	require.Nil(t, db.SetApiKey(rotated))
+	_, err = db.GetApiKey("hash2")
+	require.Equal(t, pinsdb.ErrApiKeyNotFound, err)
+	actual, err = db.GetApiKey("hash2b")
+	require.Nil(t, err)
+	require.Equal(t, rotated, actual)
+	// keys are only deleted by their owner
+	require.Equal(t, pinsdb.ErrApiKeyNotFound, db.DeleteApiKey("bob", "key1"))
+	require.Equal(t, pinsdb.ErrApiKeyNotFound, db.DeleteApiKey("alice", "missing"))
+	require.Nil(t, db.DeleteApiKey("alice", "key1"))
+	_, err = db.GetApiKey("hash1")
+	require.Equal(t, pinsdb.ErrApiKeyNotFound, err)
+	found, err = db.FindApiKeys("alice")
+	require.Nil(t, err)
+	require.Equal(t, []models.ApiKey{rotated}, found)
+}
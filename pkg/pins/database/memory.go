@@ -0,0 +1,428 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+// memory represents an in-memory implementation of the Pins interface
+type memory struct {
+	*sync.RWMutex
+	pins    map[string]models.PinStatus // keyed by pin ID
+	apiKeys map[string]models.ApiKey    // keyed by API key ID
+}
+
+// NewMemory returns a new Pins that keeps its data in memory. The data is lost
+// once the process exits.
+func NewMemory() Pins {
+	return &memory{
+		RWMutex: new(sync.RWMutex),
+		pins:    make(map[string]models.PinStatus),
+		apiKeys: make(map[string]models.ApiKey),
+	}
+}
+
+func (d *memory) Set(pinStatus models.PinStatus) error {
+	created, err := parseCreated(pinStatus.Created)
+	if err != nil {
+		return err
+	}
+	pinStatus.Created = formatCreated(created)
+	d.Lock()
+	defer d.Unlock()
+	d.pins[pinStatus.Id] = copyPinStatus(pinStatus)
+	return nil
+}
+
+func (d *memory) Patch(id string, fields map[string]interface{}) error {
+	d.Lock()
+	defer d.Unlock()
+	ps, ok := d.pins[id]
+	if !ok {
+		return ErrNotFound
+	}
+	patchPinStatus(&ps, fields)
+	d.pins[id] = ps
+	return nil
+}
+
+func (d *memory) Get(id string) (models.PinStatus, error) {
+	d.RLock()
+	defer d.RUnlock()
+	ps, ok := d.pins[id]
+	if !ok {
+		return models.PinStatus{}, ErrNotFound
+	}
+	return copyPinStatus(ps), nil
+}
+
+func (d *memory) Find(
+	owner string,
+	cids, statuses []string,
+	name string,
+	before, after int64,
+	match string,
+	limit int, offset int,
+	cursor *Cursor,
+	sortBy *SortingKey,
+	meta models.Info,
+) (models.Pins, error) {
+	if owner == "" {
+		return models.Pins{}, ErrMissingOwner
+	}
+	sortBy, err := cursorSorting(cursor, sortBy)
+	if err != nil {
+		return models.Pins{}, err
+	}
+	filter := newPinFilter(
+		owner, cids, statuses, name, before, after, match, cursor,
+		sortBy, meta,
+	)
+	d.RLock()
+	matches := []models.PinStatus{}
+	for _, ps := range d.pins {
+		if filter.matches(ps) {
+			matches = append(matches, copyPinStatus(ps))
+		}
+	}
+	d.RUnlock()
+	return pagePins(matches, limit, offset, sortBy)
+}
+
+func (d *memory) Delete(id string) error {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.pins, id)
+	return nil
+}
+
+func (d *memory) References(cid string) (int, error) {
+	d.RLock()
+	defer d.RUnlock()
+	refs := 0
+	for _, ps := range d.pins {
+		if ps.Pin.Cid == cid {
+			refs++
+		}
+	}
+	return refs, nil
+}
+
+func (d *memory) SetApiKey(key models.ApiKey) error {
+	key, err := normalizeApiKey(key)
+	if err != nil {
+		return err
+	}
+	d.Lock()
+	defer d.Unlock()
+	d.apiKeys[key.Id] = key
+	return nil
+}
+
+func (d *memory) GetApiKey(hash string) (models.ApiKey, error) {
+	d.RLock()
+	defer d.RUnlock()
+	for _, key := range d.apiKeys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return models.ApiKey{}, ErrApiKeyNotFound
+}
+
+func (d *memory) FindApiKeys(owner string) ([]models.ApiKey, error) {
+	d.RLock()
+	keys := []models.ApiKey{}
+	for _, key := range d.apiKeys {
+		if key.Owner == owner {
+			keys = append(keys, key)
+		}
+	}
+	d.RUnlock()
+	sortApiKeys(keys)
+	return keys, nil
+}
+
+func (d *memory) DeleteApiKey(owner, id string) error {
+	d.Lock()
+	defer d.Unlock()
+	key, ok := d.apiKeys[id]
+	if !ok || key.Owner != owner {
+		return ErrApiKeyNotFound
+	}
+	delete(d.apiKeys, id)
+	return nil
+}
+
+// pinFilter represents the parameters of a search for Pins
+type pinFilter struct {
+	owner     string
+	cids      []string
+	statuses  []string
+	name      string
+	before    int64
+	after     int64
+	match     string
+	cursor    *Cursor
+	ascending bool // the sorting direction following the cursor
+	meta      models.Info
+}
+
+// newPinFilter returns the pinFilter for the given Find parameters; the sorting
+// key must be set if the cursor is.
+func newPinFilter(
+	owner string,
+	cids, statuses []string,
+	name string,
+	before, after int64,
+	match string,
+	cursor *Cursor,
+	sortBy *SortingKey,
+	meta models.Info,
+) pinFilter {
+	filter := pinFilter{
+		owner:    owner,
+		cids:     cids,
+		statuses: statuses,
+		name:     name,
+		before:   before,
+		after:    after,
+		match:    match,
+		cursor:   cursor,
+		meta:     meta,
+	}
+	if cursor != nil {
+		filter.ascending = sortBy.Ascending
+	}
+	return filter
+}
+
+// matches returns true if the given Pin matches every parameter of the filter.
+func (f pinFilter) matches(ps models.PinStatus) bool {
+	if f.owner != AllOwners && ps.Owner != f.owner {
+		return false
+	}
+	if len(f.cids) > 0 && !containsString(f.cids, ps.Pin.Cid) {
+		return false
+	}
+	if len(f.statuses) > 0 && !containsString(f.statuses, ps.Status) {
+		return false
+	}
+	if f.name != "" && !matchName(ps.Pin.Name, f.name, f.match) {
+		return false
+	}
+	if f.before > 0 || f.after > 0 || f.cursor != nil {
+		created, _ := parseCreated(ps.Created)
+		if f.before > 0 && created >= f.before {
+			return false
+		}
+		if f.after > 0 && created <= f.after {
+			return false
+		}
+		if f.cursor != nil &&
+			!f.cursor.Follows(created, ps.Id, f.ascending) {
+			return false
+		}
+	}
+	return matchInfo(ps.Pin.Meta, f.meta)
+}
+
+// pagePins sorts the given Pins by the given key and returns the page of Pins
+// at the given offset. Pins are ordered by ID when their keys are equal.
+func pagePins(
+	pins []models.PinStatus,
+	limit, offset int,
+	sortBy *SortingKey,
+) (models.Pins, error) {
+	var less func(a, b models.PinStatus) bool
+	if sortBy != nil {
+		var err error
+		if less, err = memorySortFunc(*sortBy); err != nil {
+			return models.Pins{}, err
+		}
+	}
+	// ties are broken by ID, in the same direction
+	ascending := sortBy == nil || sortBy.Ascending
+	sort.Slice(pins, func(i, j int) bool {
+		return (pins[i].Id < pins[j].Id) == ascending
+	})
+	if less != nil {
+		sort.SliceStable(pins, func(i, j int) bool {
+			return less(pins[i], pins[j])
+		})
+	}
+	total := len(pins)
+	if limit < 1 {
+		limit = DefaultLimit
+	}
+	if offset > len(pins) {
+		offset = len(pins)
+	}
+	end := offset + limit
+	if end > len(pins) {
+		end = len(pins)
+	}
+	pins = pins[offset:end]
+	return models.Pins{
+		Count:   len(pins),
+		Total:   total,
+		Results: pins,
+	}, nil
+}
+
+// normalizeApiKey returns the given API key as stored; its creation time is
+// an RFC 3339 timestamp, its plain key is unset and its scopes are copied, or
+// nil if empty.
+func normalizeApiKey(key models.ApiKey) (models.ApiKey, error) {
+	created, err := parseCreated(key.Created)
+	if err != nil {
+		return models.ApiKey{}, err
+	}
+	key.Created = formatCreated(created)
+	key.Key = ""
+	if len(key.Scopes) > 0 {
+		key.Scopes = append([]string(nil), key.Scopes...)
+	} else {
+		key.Scopes = nil
+	}
+	return key, nil
+}
+
+// sortApiKeys sorts the given API keys by creation, and then by ID.
+func sortApiKeys(keys []models.ApiKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		ci, _ := parseCreated(keys[i].Created)
+		cj, _ := parseCreated(keys[j].Created)
+		if ci != cj {
+			return ci < cj
+		}
+		return keys[i].Id < keys[j].Id
+	})
+}
+
+// patchPinStatus patches the fields of the given Pin. Unknown fields, and
+// values of the wrong type, are ignored.
+func patchPinStatus(ps *models.PinStatus, fields map[string]interface{}) {
+	for key, val := range fields {
+		switch key {
+		case "status":
+			if status, ok := val.(string); ok {
+				ps.Status = status
+			}
+		case "cid":
+			if cid, ok := val.(string); ok {
+				ps.Pin.Cid = cid
+			}
+		case "name":
+			if name, ok := val.(string); ok {
+				ps.Pin.Name = name
+			}
+		case "origins":
+			if origins, ok := val.([]string); ok && origins != nil {
+				ps.Pin.Origins = append([]string{}, origins...)
+			}
+		case "meta":
+			if meta, ok := val.(models.Info); ok && meta != nil {
+				ps.Pin.Meta = copyInfo(meta)
+			}
+		case "info":
+			if info, ok := val.(models.Info); ok && info != nil {
+				ps.Info = copyInfo(info)
+			}
+		}
+	}
+}
+
+// memorySortFunc returns a function reporting whether a Pin sorts before
+// another for the given sorting key.
+func memorySortFunc(
+	sortBy SortingKey,
+) (func(a, b models.PinStatus) bool, error) {
+	var less func(a, b models.PinStatus) bool
+	switch sortBy.Field {
+	case "created":
+		less = func(a, b models.PinStatus) bool {
+			ca, _ := parseCreated(a.Created)
+			cb, _ := parseCreated(b.Created)
+			return ca < cb
+		}
+	case "name":
+		less = func(a, b models.PinStatus) bool {
+			return a.Pin.Name < b.Pin.Name
+		}
+	case "status":
+		less = func(a, b models.PinStatus) bool {
+			return a.Status < b.Status
+		}
+	case "cid":
+		less = func(a, b models.PinStatus) bool {
+			return a.Pin.Cid < b.Pin.Cid
+		}
+	default:
+		return nil, fmt.Errorf("invalid sorting field ('%s')", sortBy.Field)
+	}
+	if sortBy.Ascending {
+		return less, nil
+	}
+	return func(a, b models.PinStatus) bool { return less(b, a) }, nil
+}
+
+// matchName returns true if the given name matches the given query per the
+// text matching strategy. Exact matching is used by default.
+func matchName(name, query, match string) bool {
+	switch match {
+	case models.TextMatchIExact.String():
+		return strings.EqualFold(name, query)
+	case models.TextMatchPartial.String():
+		return strings.Contains(name, query)
+	case models.TextMatchIPartial.String():
+		return strings.Contains(
+			strings.ToLower(name),
+			strings.ToLower(query),
+		)
+	}
+	return name == query
+}
+
+// matchInfo returns true if the given info contains every key-value pair of
+// the given query.
+func matchInfo(info, query models.Info) bool {
+	for k, v := range query {
+		if val, ok := info[k]; !ok || val != v {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// copyInfo returns a copy of the given info; never nil.
+func copyInfo(info models.Info) models.Info {
+	cp := make(models.Info, len(info))
+	for k, v := range info {
+		cp[k] = v
+	}
+	return cp
+}
+
+// copyPinStatus returns a deep copy of the given Pin. Like the Pins read from
+// Redis, the copy's lists and info are never nil.
+func copyPinStatus(ps models.PinStatus) models.PinStatus {
+	ps.Pin.Origins = append([]string{}, ps.Pin.Origins...)
+	ps.Delegates = append([]string{}, ps.Delegates...)
+	ps.Pin.Meta = copyInfo(ps.Pin.Meta)
+	ps.Info = copyInfo(ps.Info)
+	return ps
+}
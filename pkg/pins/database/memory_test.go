@@ -0,0 +1,49 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+func TestMemorySetGet(t *testing.T) {
+	db := NewMemory()
+	ps := models.PinStatus{
+		Id:      "pin1",
+		Status:  "queued",
+		Created: "1621000000",
+		Pin:     models.Pin{Cid: "abc123", Name: "helloworld"},
+	}
+	require.Nil(t, db.Set(ps))
+	actual, err := db.Get(ps.Id)
+	require.Nil(t, err)
+	// changes to a returned pin are not stored
+	actual.Pin.Meta["a"] = "one"
+	actual, err = db.Get(ps.Id)
+	require.Nil(t, err)
+	require.Empty(t, actual.Pin.Meta)
+}
+
+func TestMemoryFind(t *testing.T) {
+	db := NewMemory()
+	for _, name := range []string{"b", "C", "a"} {
+		require.Nil(t, db.Set(models.PinStatus{
+			Id:      name,
+			Created: "1621000000",
+			Pin:     models.Pin{Name: name},
+		}))
+	}
+	pins, err := db.Find(AllOwners, nil, nil, "", 0, 0, "", 0, 0, nil,
+		&SortingKey{Field: "name", Ascending: true}, nil)
+	require.Nil(t, err)
+	ids := []string{}
+	for _, ps := range pins.Results {
+		ids = append(ids, ps.Id)
+	}
+	require.Equal(t, []string{"C", "a", "b"}, ids)
+	_, err = db.Find(AllOwners, nil, nil, "", 0, 0, "", 0, 0, nil,
+		&SortingKey{Field: "unknown"}, nil)
+	require.NotNil(t, err)
+}
@@ -2,11 +2,13 @@ package database
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/RediSearch/redisearch-go/redisearch"
 
@@ -16,6 +18,20 @@ import (
 const (
 	PinsIndexName = "pins"
 	PinsKeyPrefix = "pin:"
+
+	// Drivers
+	DriverRedis    = "redis"
+	DriverMemory   = "memory"
+	DriverPostgres = "postgres"
+	DriverBolt     = "bolt"
+
+	// AllOwners is passed to Find, in place of an owner, for the Pins of
+	// every owner
+	AllOwners = "*"
+
+	// DefaultLimit is the number of Pins returned by Find for a limit less
+	// than 1
+	DefaultLimit = 10
 )
 
 var (
@@ -23,7 +39,9 @@ var (
 	TokenDelimitersRe = regexp.MustCompile(`(\b|\B)([,.<>{}\[\]\"\':;!@#\$%\^&\*\(\)\-\+=~ ])(\b|\B)`)
 
 	// Errors
-	ErrNotFound = errors.New("pin not found")
+	ErrNotFound       = errors.New("pin not found")
+	ErrApiKeyNotFound = errors.New("API key not found")
+	ErrMissingOwner   = errors.New("owner is missing")
 )
 
 // Pins represents an interface to the Pins database
@@ -37,70 +55,102 @@ type Pins interface {
 	// Get returns the Pin status for a given ID
 	Get(id string) (models.PinStatus, error)
 
-	// Find returns a list of Pins for the given parameters
+	// Find returns a list of Pins for the given parameters. Only the Pins
+	// belonging to the given owner are returned, or those of every owner
+	// for AllOwners; ErrMissingOwner is returned if the owner is empty. If
+	// cursor is set, only the Pins following the cursor are returned,
+	// sorted by creation. At most DefaultLimit Pins are returned for a
+	// limit less than 1.
 	Find(
+		owner string,
 		cids, statuses []string,
 		name string,
 		before, after int64,
 		match string,
 		limit int, offset int,
+		cursor *Cursor,
 		sortBy *SortingKey,
 		meta models.Info,
 	) (models.Pins, error)
 
 	// Delete removes the Pin according to the given ID
 	Delete(id string) error
+	// References returns the number of Pins, of any owner, that reference
+	// the given CID
+	References(cid string) (int, error)
+
+	// SetApiKey adds or updates an API key; its plain key is never stored
+	SetApiKey(key models.ApiKey) error
+
+	// GetApiKey returns the API key for the given hash of the key
+	GetApiKey(hash string) (models.ApiKey, error)
+
+	// FindApiKeys returns the API keys belonging to the given owner, sorted
+	// by creation
+	FindApiKeys(owner string) ([]models.ApiKey, error)
+
+	// DeleteApiKey removes the API key, belonging to the given owner,
+	// according to the given ID
+	DeleteApiKey(owner, id string) error
+}
+
+// Open returns a new Pins for the given context and database driver. The
+// address and drop flag are passed to drivers backed by a database server; for
+// PostgreSQL, the address is a connection string, and for bbolt, the path of
+// the database file. An empty driver defaults to Redis.
+func Open(ctx context.Context, driver, addr string, drop bool) (Pins, error) {
+	switch strings.ToLower(driver) {
+	case "", DriverRedis:
+		return New(ctx, addr, drop)
+	case DriverMemory:
+		return NewMemory(), nil
+	case DriverPostgres:
+		return NewPostgres(ctx, addr, drop)
+	case DriverBolt:
+		return NewBolt(addr, drop)
+	}
+	return nil, fmt.Errorf("unknown database driver ('%s')", driver)
 }
 
 // pins represents the implementation of the Pins interface
 type pins struct {
 	*redisearch.Client
-	ctx context.Context
+	pool redisearch.ConnPool // for commands outside of the index
+	ctx  context.Context
 }
 
 // New returns a new Pins for the given context and database address. If drop is
-// set, the data is dropped from the database.
+// set, the data is dropped from the database. The database is migrated to the
+// latest schema version.
 func New(ctx context.Context, addr string, drop bool) (Pins, error) {
-	ps := &pins{
-		Client: redisearch.NewClient(addr, PinsIndexName),
-		ctx:    ctx,
-	}
+	ps := newPins(ctx, addr)
 	// If set indicated, drop the index
 	if drop {
 		ps.Drop()
+		if err := ps.dropApiKeys(); err != nil {
+			return nil, err
+		}
+		if err := ps.setSchemaVersion(0); err != nil {
+			return nil, err
+		}
 	}
-	schema := redisearch.NewSchema(redisearch.DefaultOptions).
-		AddField(redisearch.NewTextField("status")).
-		AddField(redisearch.NewNumericField("created")).
-		AddField(redisearch.NewTextField("cid")).
-		AddField(redisearch.NewSortableTextField("name", 1.0)).
-		AddField(redisearch.NewTagField("origins")).
-		AddField(redisearch.NewTagFieldOptions(
-			"meta", redisearch.TagFieldOptions{
-				Separator: ',',
-				NoIndex:   false,
-				Sortable:  true,
-			})).
-		AddField(redisearch.NewTagField("delegates")).
-		AddField(redisearch.NewTagFieldOptions(
-			"info", redisearch.TagFieldOptions{
-				Separator: ',',
-				NoIndex:   false,
-				Sortable:  true,
-			}))
-	indexExists, err := containsIndex(ps.Client, PinsIndexName)
-	if err != nil {
+	if _, _, err := ps.migrate(); err != nil {
 		return nil, err
-	} else if !indexExists {
-		indexDefinition := redisearch.NewIndexDefinition().
-			AddPrefix(PinsKeyPrefix)
-		err = ps.CreateIndexWithIndexDefinition(schema, indexDefinition)
 	}
-	return ps, err
+	return ps, nil
+}
+
+// newPins returns a new pins for the given context and database address.
+func newPins(ctx context.Context, addr string) *pins {
+	return &pins{
+		Client: redisearch.NewClient(addr, PinsIndexName),
+		pool:   newRedisPool(addr),
+		ctx:    ctx,
+	}
 }
 
 func (d *pins) Set(pinStatus models.PinStatus) error {
-	created, err := strconv.ParseInt(pinStatus.Created, 10, 64)
+	created, err := parseCreated(pinStatus.Created)
 	if err != nil {
 		return err
 	}
@@ -110,10 +160,14 @@ func (d *pins) Set(pinStatus models.PinStatus) error {
 		Set("created", created).
 		Set("cid", pinStatus.Pin.Cid).
 		Set("name", escapeString(pinStatus.Pin.Name)).
+		Set("name_exact", redisExactName(pinStatus.Pin.Name)).
 		Set("origins", strings.Join(pinStatus.Pin.Origins, ",")).
 		Set("meta", pinStatus.Pin.Meta.String()).
 		Set("delegates", strings.Join(pinStatus.Delegates, ",")).
-		Set("info", pinStatus.Info.String())
+		Set("info", pinStatus.Info.String()).
+		Set("owner", pinStatus.Owner).
+		Set("position", redisPosition(created, pinStatus.Id)).
+		Set(PinsSchemaVersionField, PinsSchemaVersion)
 	return d.Index(doc)
 }
 
@@ -131,17 +185,22 @@ func (d *pins) Patch(id string, fields map[string]interface{}) error {
 		switch key {
 		case "status":
 			i = val
+		case "cid":
+			i = val
 		case "name":
 			if name, ok := val.(string); ok {
 				i = escapeString(name)
+				doc.Set("name_exact", redisExactName(name))
 			}
 		case "origins":
 			if origins, ok := val.([]string); ok && origins != nil {
 				i = strings.Join(origins, ",")
 			}
 		case "meta":
+			fallthrough
+		case "info":
 			if info, ok := val.(models.Info); ok && info != nil {
-				i = info
+				i = info.String()
 			}
 		case "#":
 			i = val
@@ -174,20 +233,122 @@ type SortingKey struct {
 }
 
 func (d *pins) Find(
+	owner string,
 	cids, statuses []string,
 	name string,
 	before, after int64,
 	match string,
 	limit int, offset int,
+	cursor *Cursor,
 	sortBy *SortingKey,
 	meta models.Info,
 ) (models.Pins, error) {
+	if owner == "" {
+		return models.Pins{}, ErrMissingOwner
+	}
+	sortBy, err := cursorSorting(cursor, sortBy)
+	if err != nil {
+		return models.Pins{}, err
+	}
+	queryString := redisFindQuery(
+		owner, cids, statuses, name, before, after, match, meta,
+	)
+	// pins created at the same time as the cursor, and preceding it, are
+	// skipped
+	skip := 0
+	if cursor != nil {
+		skip, err = d.cursorSkip(queryString, *cursor, sortBy.Ascending)
+		if err != nil {
+			return models.Pins{}, err
+		}
+		created := fmt.Sprintf("@created:[%d +inf]", cursor.Created)
+		if !sortBy.Ascending {
+			created = fmt.Sprintf("@created:[-inf %d]", cursor.Created)
+		}
+		queryString = redisAndQuery(queryString, created)
+	}
+	q := redisearch.NewQuery(queryString)
+	if limit < 1 {
+		limit = DefaultLimit
+	}
+	q.Limit(offset+skip, limit)
+	if sortBy != nil {
+		field := sortBy.Field
+		if field == "created" {
+			// ties are broken by ID
+			field = "position"
+		}
+		q.SetSortBy(field, sortBy.Ascending)
+	}
+	docs, total, err := d.Client.Search(q)
+	if err != nil {
+		return models.Pins{}, err
+	}
+	pins := []models.PinStatus{}
+	for _, doc := range docs {
+		pins = append(pins, parsePinStatusDoc(doc))
+	}
+	return models.Pins{
+		Count:   len(pins),
+		Total:   total - skip,
+		Results: pins,
+	}, nil
+}
+
+// cursorSkip returns the number of Pins, matching the given query, created at
+// the same time as the cursor that do not follow it. Sorted by position, these
+// Pins precede the Pins that follow the cursor.
+func (d *pins) cursorSkip(
+	queryString string,
+	cursor Cursor,
+	ascending bool,
+) (int, error) {
+	queryString = redisAndQuery(queryString, fmt.Sprintf(
+		"@created:[%d %d]", cursor.Created, cursor.Created))
+	q := redisearch.NewQuery(queryString).
+		SetFlags(redisearch.QueryNoContent).
+		Limit(0, 0)
+	_, total, err := d.Client.Search(q)
+	if err != nil || total == 0 {
+		return 0, err
+	}
+	docs, _, err := d.Client.Search(q.Limit(0, total))
+	if err != nil {
+		return 0, err
+	}
+	skip := 0
+	for _, doc := range docs {
+		id := strings.TrimPrefix(doc.Id, PinsKeyPrefix)
+		if !cursor.Follows(cursor.Created, id, ascending) {
+			skip++
+		}
+	}
+	return skip, nil
+}
+
+// redisFindQuery returns the RediSearch query string for the given Find
+// parameters.
+func redisFindQuery(
+	owner string,
+	cids, statuses []string,
+	name string,
+	before, after int64,
+	match string,
+	meta models.Info,
+) string {
 	raw := []string{}
+	if owner != AllOwners {
+		// filter by the owner of the pins
+		raw = append(
+			raw,
+			fmt.Sprintf("@owner:{%s}", escapeString(owner)),
+		)
+	}
 	if len(cids) > 0 {
 		// filter by list of cids
 		raw = append(
 			raw,
-			fmt.Sprintf("@cid:(%s) ", strings.Join(cids, "|")),
+			fmt.Sprintf("@cid:(%s)", strings.Join(cids, "|")),
 		)
 	}
 	if len(statuses) > 0 {
@@ -201,25 +362,31 @@ func (d *pins) Find(
 		)
 	}
 	if name != "" {
-		name = escapeString(name)
+		// search for name; text is matched case-insensitively, so
+		// exact names are matched by their tag
 		switch match {
 		case models.TextMatchExact.String():
-			fallthrough
+			raw = append(raw, fmt.Sprintf(
+				"@name_exact:{%s}", redisExactName(name)))
 		case models.TextMatchIExact.String():
-			name = fmt.Sprintf("(%s)", name)
+			raw = append(raw, fmt.Sprintf(
+				"@name:(%s)", escapeString(name)))
 		case models.TextMatchPartial.String():
 			fallthrough
 		case models.TextMatchIPartial.String():
-			name = fmt.Sprintf("~(%s)", name)
+			raw = append(raw, fmt.Sprintf(
+				"@name:(*%s*)", escapeString(name)))
+		default:
+			raw = append(raw, fmt.Sprintf(
+				"@name:%s", escapeString(name)))
 		}
-		// prefix search for name
-		raw = append(raw, fmt.Sprintf("@name:%s", name))
 	}
+	// per the pinning service API, both bounds are exclusive
 	if after > 0 && before > 0 {
 		// filter within date range
 		raw = append(
 			raw,
-			fmt.Sprintf("@created:[%d %d]", after, before),
+			fmt.Sprintf("@created:[(%d (%d]", after, before),
 		)
 	} else if after > 0 {
 		// filter by lower range
@@ -228,39 +395,15 @@ func (d *pins) Find(
 		// filter by upper range
 		raw = append(raw, fmt.Sprintf("@created:[-inf (%d]", before))
 	}
-	if len(meta) > 0 {
-		var ss []string
-		keys := meta.Keys()
-		for _, k := range keys {
-			ss = append(ss, escapeString(fmt.Sprintf("%s:%s", k, meta[k])))
-		}
-		raw = append(raw, fmt.Sprintf("@meta:{%s}",
-			strings.Join(ss, "|")))
-	}
-	queryString := "*"
-	if len(raw) > 0 {
-		queryString = strings.Join(raw, " ")
-	}
-	q := redisearch.NewQuery(queryString)
-	if limit > 0 {
-		q.Limit(offset, limit)
+	// filter by every key-value pair of meta
+	for _, k := range meta.Keys() {
+		pair := models.Info{k: meta[k]}.String()
+		raw = append(raw, fmt.Sprintf("@meta:{%s}", escapeString(pair)))
 	}
-	if sortBy != nil {
-		q.SetSortBy(sortBy.Field, sortBy.Ascending)
-	}
-	docs, total, err := d.Client.Search(q)
-	if err != nil {
-		return models.Pins{}, err
-	}
-	pins := []models.PinStatus{}
-	for _, doc := range docs {
-		pins = append(pins, parsePinStatusDoc(doc))
+	if len(raw) == 0 {
+		return "*"
 	}
-	return models.Pins{
-		Count:   len(pins),
-		Total:   total,
-		Results: pins,
-	}, nil
+	return strings.Join(raw, " ")
 }
 
 func (d *pins) Delete(id string) error {
@@ -268,6 +411,17 @@ func (d *pins) Delete(id string) error {
 	return d.Client.DeleteDocument(index)
 }
 
+func (d *pins) References(cid string) (int, error) {
+	q := redisearch.NewQuery(fmt.Sprintf("@cid:(%s)", cid)).
+		SetFlags(redisearch.QueryVerbatim|redisearch.QueryNoContent).
+		Limit(0, 0)
+	_, total, err := d.Client.Search(q)
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
 func parsePinStatusDoc(doc redisearch.Document) models.PinStatus {
 	status := models.StatusUndefined
 	if s, ok := doc.Properties["status"]; ok && s != nil {
@@ -276,6 +430,9 @@ func parsePinStatusDoc(doc redisearch.Document) models.PinStatus {
 	created := ""
 	if c, ok := doc.Properties["created"]; ok && c != nil {
 		created = c.(string)
+		if ms, err := strconv.ParseInt(created, 10, 64); err == nil {
+			created = formatCreated(ms)
+		}
 	}
 	cid := ""
 	if c, ok := doc.Properties["cid"]; ok && c != nil {
@@ -306,6 +463,10 @@ func parsePinStatusDoc(doc redisearch.Document) models.PinStatus {
 	if i, ok := doc.Properties["info"]; ok && i != nil {
 		info = i.(string)
 	}
+	owner := ""
+	if o, ok := doc.Properties["owner"]; ok && o != nil {
+		owner = o.(string)
+	}
 	return models.PinStatus{
 		Id:      strings.TrimPrefix(doc.Id, PinsKeyPrefix),
 		Status:  status.String(),
@@ -318,7 +479,57 @@ func parsePinStatusDoc(doc redisearch.Document) models.PinStatus {
 		},
 		Delegates: delegates,
 		Info:      models.InfoFromString(info),
+		Owner:     owner,
+	}
+}
+
+// newRedisPool returns a connection pool for the given address; a comma
+// separated list of addresses is pooled across all hosts.
+func newRedisPool(addr string) redisearch.ConnPool {
+	addrs := strings.Split(addr, ",")
+	if len(addrs) == 1 {
+		return redisearch.NewSingleHostPool(addrs[0])
 	}
+	return redisearch.NewMultiHostPool(addrs)
+}
+
+// parseCreated returns the creation time, in Unix milliseconds, of the given
+// timestamp. Unix timestamps in seconds, as created prior to RFC 3339
+// timestamps, are accepted.
+func parseCreated(s string) (int64, error) {
+	t, err := models.ParseTime(s, true)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixMilli(), nil
+}
+
+// formatCreated returns the timestamp of the given creation time in Unix
+// milliseconds.
+func formatCreated(ms int64) string {
+	return models.FormatTime(time.UnixMilli(ms))
+}
+
+// redisAndQuery returns the intersection of the given query and clause.
+func redisAndQuery(queryString, clause string) string {
+	if queryString == "*" {
+		return clause
+	}
+	return queryString + " " + clause
+}
+
+// redisPosition returns the value of a document's position field, by which
+// documents are sorted by creation and then ID. The field is sorted as a tag,
+// normalized to lowercase; Pin IDs are expected in lowercase.
+func redisPosition(created int64, id string) string {
+	return fmt.Sprintf("%020d:%s", created, id)
+}
+
+// redisExactName returns the value of a document's name_exact field, by which
+// names are matched exactly. Tags are normalized to lowercase, so the name is
+// hex encoded to preserve its case; this also leaves no characters to escape.
+func redisExactName(name string) string {
+	return hex.EncodeToString([]byte(name))
 }
 
 func escapeString(s string) string {
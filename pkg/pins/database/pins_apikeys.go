@@ -0,0 +1,159 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+const (
+	// ApiKeysKeyPrefix is the prefix of the hashes of API keys, by ID
+	ApiKeysKeyPrefix = "apikey:"
+
+	// ApiKeyHashKeyPrefix is the prefix of the keys mapping the hash of an
+	// API key onto its ID
+	ApiKeyHashKeyPrefix = "apikey_hash:"
+
+	// ApiKeyOwnerKeyPrefix is the prefix of the sets of API key IDs, by owner
+	ApiKeyOwnerKeyPrefix = "apikeys:"
+)
+
+func (d *pins) SetApiKey(key models.ApiKey) error {
+	key, err := normalizeApiKey(key)
+	if err != nil {
+		return err
+	}
+	conn := d.pool.Get()
+	defer conn.Close()
+	prev, err := redisGetApiKey(conn, key.Id)
+	if err != nil && err != ErrApiKeyNotFound {
+		return err
+	}
+	conn.Send("MULTI")
+	if err == nil {
+		conn.Send("DEL", ApiKeyHashKeyPrefix+prev.Hash)
+		conn.Send("SREM", ApiKeyOwnerKeyPrefix+prev.Owner, prev.Id)
+	}
+	conn.Send(
+		"HSET", ApiKeysKeyPrefix+key.Id,
+		"id", key.Id,
+		"name", key.Name,
+		"prefix", key.Prefix,
+		"created", key.Created,
+		"hash", key.Hash,
+		"owner", key.Owner,
+		"grant", key.Grant,
+		"scopes", strings.Join(key.Scopes, " "),
+	)
+	conn.Send("SET", ApiKeyHashKeyPrefix+key.Hash, key.Id)
+	conn.Send("SADD", ApiKeyOwnerKeyPrefix+key.Owner, key.Id)
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+func (d *pins) GetApiKey(hash string) (models.ApiKey, error) {
+	conn := d.pool.Get()
+	defer conn.Close()
+	id, err := redis.String(conn.Do("GET", ApiKeyHashKeyPrefix+hash))
+	if err == redis.ErrNil {
+		return models.ApiKey{}, ErrApiKeyNotFound
+	} else if err != nil {
+		return models.ApiKey{}, err
+	}
+	return redisGetApiKey(conn, id)
+}
+
+func (d *pins) FindApiKeys(owner string) ([]models.ApiKey, error) {
+	conn := d.pool.Get()
+	defer conn.Close()
+	ids, err := redis.Strings(conn.Do("SMEMBERS", ApiKeyOwnerKeyPrefix+owner))
+	if err != nil {
+		return nil, err
+	}
+	keys := []models.ApiKey{}
+	for _, id := range ids {
+		key, err := redisGetApiKey(conn, id)
+		if err == ErrApiKeyNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	sortApiKeys(keys)
+	return keys, nil
+}
+
+func (d *pins) DeleteApiKey(owner, id string) error {
+	conn := d.pool.Get()
+	defer conn.Close()
+	key, err := redisGetApiKey(conn, id)
+	if err != nil {
+		return err
+	}
+	if key.Owner != owner {
+		return ErrApiKeyNotFound
+	}
+	conn.Send("MULTI")
+	conn.Send("DEL", ApiKeysKeyPrefix+key.Id)
+	conn.Send("DEL", ApiKeyHashKeyPrefix+key.Hash)
+	conn.Send("SREM", ApiKeyOwnerKeyPrefix+key.Owner, key.Id)
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+// dropApiKeys removes every API key from the database.
+func (d *pins) dropApiKeys() error {
+	conn := d.pool.Get()
+	defer conn.Close()
+	cursor := 0
+	for {
+		reply, err := redis.Values(conn.Do(
+			"SCAN", cursor,
+			"MATCH", "apikey*",
+			"COUNT", migrationScanCount,
+		))
+		if err != nil {
+			return err
+		}
+		var keys []string
+		if _, err := redis.Scan(reply, &cursor, &keys); err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			args := redis.Args{}.AddFlat(keys)
+			if _, err := conn.Do("DEL", args...); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// redisGetApiKey returns the API key for the given ID.
+func redisGetApiKey(conn redis.Conn, id string) (models.ApiKey, error) {
+	doc, err := redis.StringMap(conn.Do("HGETALL", ApiKeysKeyPrefix+id))
+	if err != nil {
+		return models.ApiKey{}, err
+	}
+	if len(doc) == 0 {
+		return models.ApiKey{}, ErrApiKeyNotFound
+	}
+	key := models.ApiKey{
+		Id:      doc["id"],
+		Name:    doc["name"],
+		Prefix:  doc["prefix"],
+		Created: doc["created"],
+		Hash:    doc["hash"],
+		Owner:   doc["owner"],
+		Grant:   doc["grant"],
+	}
+	if scopes := strings.Fields(doc["scopes"]); len(scopes) > 0 {
+		key.Scopes = scopes
+	}
+	return key, nil
+}
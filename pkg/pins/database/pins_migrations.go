@@ -0,0 +1,415 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RediSearch/redisearch-go/redisearch"
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+const (
+	// PinsSchemaVersionKey is the key of the schema version of the pins index
+	// and documents
+	PinsSchemaVersionKey = "pins:schema_version"
+
+	// PinsSchemaVersionField is the field of a document holding the schema
+	// version to which the document has been migrated
+	PinsSchemaVersionField = "schema_version"
+
+	// PinsMigrationLockKey is the key of the lock held while migrating the
+	// pins database
+	PinsMigrationLockKey = "pins:migration_lock"
+
+	// migrationLockTimeout is the time after which a migration lock expires,
+	// and the time waited for a lock held by another instance
+	migrationLockTimeout = 10 * time.Minute
+
+	// migrationScanCount is the number of keys requested per scan when
+	// backfilling documents
+	migrationScanCount = 1000
+
+	// maxCreatedSeconds is the largest creation time taken to be in Unix
+	// seconds; larger times, past the year 5138 in seconds, are in
+	// milliseconds
+	maxCreatedSeconds = 1e11
+)
+
+var (
+	// PinsSchemaVersion is the latest schema version of the pins database
+	PinsSchemaVersion = len(redisMigrations)
+
+	// Errors
+	ErrMigrationLocked = errors.New("timed out waiting for migration lock")
+)
+
+// redisMigration represents a change to the schema of the pins database. Fields
+// are added to the index before the documents are backfilled.
+type redisMigration struct {
+	// Description describes the change
+	Description string
+
+	// Fields is the list of fields added to the index
+	Fields []redisearch.Field
+
+	// Backfill returns the fields to set for the document of the given Pin
+	// ID and fields. The document is left unchanged if no fields are
+	// returned.
+	Backfill func(id string, doc map[string]string) map[string]string
+}
+
+// redisMigrations is the ordered list of migrations of the pins database; a
+// database at version N has had the first N migrations applied. Migrations
+// must only be appended.
+var redisMigrations = []redisMigration{
+	{
+		Description: "store meta and info losslessly encoded",
+		Backfill:    backfillInfoEncoding,
+	},
+	{
+		Description: "add the position for sorting by creation and ID",
+		Fields: []redisearch.Field{
+			redisearch.NewTagFieldOptions(
+				"position", redisearch.TagFieldOptions{
+					Separator: ',',
+					NoIndex:   true,
+					Sortable:  true,
+				}),
+		},
+		Backfill: backfillPosition,
+	},
+	{
+		Description: "store created in milliseconds",
+		Backfill:    backfillCreatedMillis,
+	},
+	{
+		// pins predating ownership are left without an owner; see
+		// Migrate
+		Description: "index the owner of pins",
+		Fields: []redisearch.Field{
+			redisearch.NewTagField("owner"),
+		},
+	},
+	{
+		Description: "index names for case-sensitive exact matching",
+		Fields: []redisearch.Field{
+			redisearch.NewTagField("name_exact"),
+		},
+		Backfill: backfillExactName,
+	},
+}
+
+// redisUnlockScript deletes the lock at KEYS[1] if it holds the token ARGV[1]
+var redisUnlockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Migrate migrates the Redis pins database at the given address to the latest
+// schema version, creating the pins index if it does not exist. If an owner is
+// given, pins without an owner, such as those predating ownership, are
+// assigned to it. Returns the schema versions from, and to, which the database
+// was migrated.
+func Migrate(ctx context.Context, addr, owner string) (int, int, error) {
+	d := newPins(ctx, addr)
+	from, to, err := d.migrate()
+	if err != nil || owner == "" {
+		return from, to, err
+	}
+	if owner == AllOwners {
+		return from, to, ErrMissingOwner
+	}
+	return from, to, d.backfill(backfillOwner(owner))
+}
+
+// redisSchema returns the schema of the pins index at the given version.
+func redisSchema(version int) *redisearch.Schema {
+	schema := redisearch.NewSchema(redisearch.DefaultOptions).
+		AddField(redisearch.NewTextField("status")).
+		AddField(redisearch.NewNumericField("created")).
+		AddField(redisearch.NewTextField("cid")).
+		AddField(redisearch.NewSortableTextField("name", 1.0)).
+		AddField(redisearch.NewTagField("origins")).
+		AddField(redisearch.NewTagFieldOptions(
+			"meta", redisearch.TagFieldOptions{
+				Separator: ',',
+				NoIndex:   false,
+				Sortable:  true,
+			})).
+		AddField(redisearch.NewTagField("delegates")).
+		AddField(redisearch.NewTagFieldOptions(
+			"info", redisearch.TagFieldOptions{
+				Separator: ',',
+				NoIndex:   false,
+				Sortable:  true,
+			}))
+	for _, m := range redisMigrations[:version] {
+		for _, f := range m.Fields {
+			schema.AddField(f)
+		}
+	}
+	return schema
+}
+
+// migrate applies the pending migrations, while holding the migration lock, and
+// returns the schema versions from, and to, which the database was migrated. If
+// missing, the pins index is created at the current version first.
+func (d *pins) migrate() (int, int, error) {
+	unlock, err := d.lockMigrations()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+	from, err := d.schemaVersion()
+	if err != nil {
+		return 0, 0, err
+	}
+	if from > PinsSchemaVersion {
+		return from, from, fmt.Errorf(
+			"schema version (%d) is newer than supported (%d)",
+			from, PinsSchemaVersion,
+		)
+	}
+	indexExists, err := containsIndex(d.Client, PinsIndexName)
+	if err != nil {
+		return from, from, err
+	} else if !indexExists {
+		indexDefinition := redisearch.NewIndexDefinition().
+			AddPrefix(PinsKeyPrefix)
+		err = d.CreateIndexWithIndexDefinition(
+			redisSchema(from),
+			indexDefinition,
+		)
+		if err != nil {
+			return from, from, err
+		}
+	}
+	for version := from; version < PinsSchemaVersion; version++ {
+		err := d.applyMigration(version, redisMigrations[version])
+		if err != nil {
+			return from, version, fmt.Errorf(
+				"failed to migrate to version %d: %s",
+				version+1, err,
+			)
+		}
+		if err := d.setSchemaVersion(version + 1); err != nil {
+			return from, version, err
+		}
+	}
+	return from, PinsSchemaVersion, nil
+}
+
+// applyMigration adds the fields of the given migration, from the given
+// version, to the pins index and backfills every document in place. Fields
+// already in the index, such as those of an index created before the field was
+// migrated, are skipped.
+func (d *pins) applyMigration(version int, m redisMigration) error {
+	for _, f := range m.Fields {
+		err := d.AddField(f)
+		if err != nil && !isDuplicateField(err) {
+			return err
+		}
+	}
+	if m.Backfill == nil {
+		return nil
+	}
+	return d.backfill(migrationBackfill(version, m))
+}
+
+// migrationBackfill returns the backfill of the given migration, from the
+// given version, marking each backfilled document as migrated. Documents
+// already migrated, by an interrupted run of the migration or since written at
+// a later version, are skipped.
+func migrationBackfill(
+	version int,
+	m redisMigration,
+) func(id string, doc map[string]string) map[string]string {
+	return func(id string, doc map[string]string) map[string]string {
+		// documents without a version predate versioned documents
+		docVersion, _ := strconv.Atoi(doc[PinsSchemaVersionField])
+		if docVersion > version {
+			return nil
+		}
+		fields := m.Backfill(id, doc)
+		if fields == nil {
+			fields = make(map[string]string)
+		}
+		fields[PinsSchemaVersionField] = strconv.Itoa(version + 1)
+		return fields
+	}
+}
+
+// backfill sets the fields returned by the given function for every document
+// in place.
+func (d *pins) backfill(
+	fn func(id string, doc map[string]string) map[string]string,
+) error {
+	conn := d.pool.Get()
+	defer conn.Close()
+	cursor := 0
+	for {
+		reply, err := redis.Values(conn.Do(
+			"SCAN", cursor,
+			"MATCH", PinsKeyPrefix+"*",
+			"COUNT", migrationScanCount,
+		))
+		if err != nil {
+			return err
+		}
+		var keys []string
+		if _, err := redis.Scan(reply, &cursor, &keys); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			doc, err := redis.StringMap(conn.Do("HGETALL", key))
+			if err != nil {
+				return err
+			}
+			id := strings.TrimPrefix(key, PinsKeyPrefix)
+			fields := fn(id, doc)
+			if len(fields) == 0 {
+				continue
+			}
+			args := redis.Args{}.Add(key).AddFlat(fields)
+			if _, err := conn.Do("HSET", args...); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// isDuplicateField returns true if the given error is RediSearch's error for
+// adding a field already in the index's schema.
+func isDuplicateField(err error) bool {
+	return strings.Contains(err.Error(), "Duplicate field")
+}
+
+// lockMigrations acquires the migration lock, waiting for any lock held by
+// another instance, and returns the function releasing it.
+func (d *pins) lockMigrations() (func(), error) {
+	conn := d.pool.Get()
+	defer conn.Close()
+	token := uuid.New().String()
+	deadline := time.Now().Add(migrationLockTimeout)
+	for {
+		_, err := redis.String(conn.Do(
+			"SET", PinsMigrationLockKey, token,
+			"NX", "PX", migrationLockTimeout.Milliseconds(),
+		))
+		if err == nil {
+			break
+		} else if err != redis.ErrNil {
+			return nil, err
+		} else if time.Now().After(deadline) {
+			return nil, ErrMigrationLocked
+		}
+		select {
+		case <-d.ctx.Done():
+			return nil, d.ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+	return func() {
+		conn := d.pool.Get()
+		defer conn.Close()
+		redisUnlockScript.Do(conn, PinsMigrationLockKey, token)
+	}, nil
+}
+
+// schemaVersion returns the schema version of the pins database. Returns 0 if
+// the version has never been set.
+func (d *pins) schemaVersion() (int, error) {
+	conn := d.pool.Get()
+	defer conn.Close()
+	version, err := redis.Int(conn.Do("GET", PinsSchemaVersionKey))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return version, err
+}
+
+// setSchemaVersion sets the schema version of the pins database.
+func (d *pins) setSchemaVersion(version int) error {
+	conn := d.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SET", PinsSchemaVersionKey, version)
+	return err
+}
+
+// backfillInfoEncoding re-encodes the meta and info maps of a document, stored
+// as unescaped key-value pairs prior to version 1.
+func backfillInfoEncoding(_ string, doc map[string]string) map[string]string {
+	return map[string]string{
+		"meta": legacyInfoFromString(doc["meta"]).String(),
+		"info": legacyInfoFromString(doc["info"]).String(),
+	}
+}
+
+// backfillPosition sets the position of a document, added in version 2.
+func backfillPosition(id string, doc map[string]string) map[string]string {
+	created, err := strconv.ParseInt(doc["created"], 10, 64)
+	if err != nil {
+		// unsortable by creation; sorted first
+		created = 0
+	}
+	return map[string]string{"position": redisPosition(created, id)}
+}
+
+// backfillCreatedMillis converts the creation time, and position, of a
+// document from Unix seconds to milliseconds, as stored since version 3.
+// Creation times already in milliseconds are left unchanged.
+func backfillCreatedMillis(id string, doc map[string]string) map[string]string {
+	created, err := strconv.ParseInt(doc["created"], 10, 64)
+	if err != nil || created > maxCreatedSeconds {
+		return nil
+	}
+	created *= 1000
+	return map[string]string{
+		"created":  strconv.FormatInt(created, 10),
+		"position": redisPosition(created, id),
+	}
+}
+
+// backfillExactName sets the exact name of a document, added in version 5.
+func backfillExactName(_ string, doc map[string]string) map[string]string {
+	name := unescapeString(doc["name"])
+	return map[string]string{"name_exact": redisExactName(name)}
+}
+
+// backfillOwner returns the backfill assigning documents without an owner to
+// the given owner.
+func backfillOwner(
+	owner string,
+) func(id string, doc map[string]string) map[string]string {
+	return func(_ string, doc map[string]string) map[string]string {
+		if doc["owner"] != "" {
+			return nil
+		}
+		return map[string]string{"owner": owner}
+	}
+}
+
+// legacyInfoFromString returns the Info for the given string of unescaped
+// key-value pairs, as stored prior to version 1.
+func legacyInfoFromString(s string) models.Info {
+	info := make(models.Info)
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, ":", 2)
+		if len(parts) == 2 {
+			info[parts[0]] = parts[1]
+		}
+	}
+	return info
+}
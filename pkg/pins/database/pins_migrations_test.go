@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+func TestRedisSchema(t *testing.T) {
+	base := len(redisSchema(0).Fields)
+	for version := 0; version <= PinsSchemaVersion; version++ {
+		added := 0
+		for _, m := range redisMigrations[:version] {
+			added += len(m.Fields)
+		}
+		require.Len(t, redisSchema(version).Fields, base+added)
+	}
+}
+
+func TestBackfillInfoEncoding(t *testing.T) {
+	fields := backfillInfoEncoding("pin1", map[string]string{
+		"status": "pinned",
+		"meta":   "time:12:30,url:a%2Cb",
+	})
+	require.Equal(t, map[string]string{
+		"meta": "time:12%3A30,url:a%252Cb",
+		"info": "",
+	}, fields)
+	require.Equal(
+		t,
+		models.Info{"time": "12:30", "url": "a%2Cb"},
+		models.InfoFromString(fields["meta"]),
+	)
+}
+
+func TestMigrationBackfill(t *testing.T) {
+	backfill := migrationBackfill(0, redisMigrations[0])
+	legacy := map[string]string{"meta": "time:12:30"}
+	require.Equal(t, map[string]string{
+		"meta":                 "time:12%3A30",
+		"info":                 "",
+		PinsSchemaVersionField: "1",
+	}, backfill("pin1", legacy))
+	// migrated documents are not backfilled again
+	require.Nil(t, backfill("pin1", map[string]string{
+		"meta":                 "time:12%3A30",
+		PinsSchemaVersionField: "1",
+	}))
+	require.Nil(t, backfill("pin1", map[string]string{
+		PinsSchemaVersionField: strconv.Itoa(PinsSchemaVersion),
+	}))
+	// documents are marked even if left unchanged
+	backfill = migrationBackfill(2, redisMigrations[2])
+	require.Equal(t, map[string]string{
+		PinsSchemaVersionField: "3",
+	}, backfill("pin1", map[string]string{}))
+}
+
+func TestLegacyInfoFromString(t *testing.T) {
+	require.Equal(t, models.Info{}, legacyInfoFromString(""))
+	require.Equal(
+		t,
+		models.Info{"a": "one", "time": "12:30", "url": "a%2Cb"},
+		legacyInfoFromString("a:one,time:12:30,url:a%2Cb,invalid"),
+	)
+}
+
+func TestRedisMigrate(t *testing.T) {
+	addr := os.Getenv(RedisAddrEnv)
+	if addr == "" {
+		t.Skipf("%s is not set", RedisAddrEnv)
+	}
+	ctx := context.Background()
+	db, err := New(ctx, addr, true)
+	require.Nil(t, err)
+	d := db.(*pins)
+	version, err := d.schemaVersion()
+	require.Nil(t, err)
+	require.Equal(t, PinsSchemaVersion, version)
+	// store a document as it was prior to versioning
+	conn := d.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do(
+		"HSET", PinsKeyPrefix+"pin1",
+		"status", "pinned",
+		"created", 1621000000,
+		"cid", "abc123",
+		"meta", "time:12:30,url:a%2Cb",
+		"info", "status_details:a b",
+	)
+	require.Nil(t, err)
+	// and one migrated by an interrupted run
+	_, err = conn.Do(
+		"HSET", PinsKeyPrefix+"pin2",
+		"status", "pinned",
+		"created", 1621000000,
+		"cid", "abc123",
+		"meta", "time:12%3A30",
+		PinsSchemaVersionField, 1,
+	)
+	require.Nil(t, err)
+	require.Nil(t, d.setSchemaVersion(0))
+	from, to, err := Migrate(ctx, addr, "")
+	require.Nil(t, err)
+	require.Equal(t, 0, from)
+	require.Equal(t, PinsSchemaVersion, to)
+	ps, err := db.Get("pin1")
+	require.Nil(t, err)
+	require.Equal(t, models.Info{"time": "12:30", "url": "a%2Cb"}, ps.Pin.Meta)
+	require.Equal(t, models.Info{"status_details": "a b"}, ps.Info)
+	require.Equal(t, "2021-05-14T13:46:40.000Z", ps.Created)
+	ps, err = db.Get("pin2")
+	require.Nil(t, err)
+	require.Equal(t, models.Info{"time": "12:30"}, ps.Pin.Meta)
+	pins, err := db.Find(AllOwners, nil, nil, "", 0, 0, "", 0, 0, nil, nil,
+		models.Info{"url": "a%2Cb"})
+	require.Nil(t, err)
+	require.Equal(t, 1, pins.Total)
+	// the pin predates ownership
+	pins, err = db.Find("myuserid", nil, nil, "", 0, 0, "", 0, 0, nil, nil, nil)
+	require.Nil(t, err)
+	require.Equal(t, 0, pins.Total)
+	// migrating an up to date database assigns pins without an owner
+	from, to, err = Migrate(ctx, addr, "myuserid")
+	require.Nil(t, err)
+	require.Equal(t, PinsSchemaVersion, from)
+	require.Equal(t, PinsSchemaVersion, to)
+	pins, err = db.Find("myuserid", nil, nil, "", 0, 0, "", 0, 0, nil, nil, nil)
+	require.Nil(t, err)
+	require.Equal(t, 2, pins.Total)
+	// the migration lock is released
+	exists, err := redis.Int(conn.Do("EXISTS", PinsMigrationLockKey))
+	require.Nil(t, err)
+	require.Equal(t, 0, exists)
+}
+
+func TestBackfillCreatedMillis(t *testing.T) {
+	require.Equal(t, map[string]string{
+		"created":  "1621000000000",
+		"position": "00000001621000000000:pin1",
+	}, backfillCreatedMillis("pin1", map[string]string{"created": "1621000000"}))
+	require.Nil(t, backfillCreatedMillis("pin1", map[string]string{}))
+	// already in milliseconds
+	require.Nil(t, backfillCreatedMillis("pin1", map[string]string{
+		"created": "1621000000000",
+	}))
+}
+
+func TestBackfillExactName(t *testing.T) {
+	require.Equal(
+		t,
+		map[string]string{"name_exact": redisExactName("Hello, World")},
+		backfillExactName("pin1", map[string]string{
+			"name": `Hello\,\ World`,
+		}),
+	)
+}
+
+func TestBackfillOwner(t *testing.T) {
+	backfill := backfillOwner("myuserid")
+	require.Equal(
+		t,
+		map[string]string{"owner": "myuserid"},
+		backfill("pin1", map[string]string{"status": "pinned"}),
+	)
+	require.Nil(t, backfill("pin1", map[string]string{"owner": "other"}))
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+// RedisAddrEnv is the environment variable holding the address of the
+// RediSearch enabled Redis used by the integration tests. The tests are skipped
+// if unset; the database's pins are dropped.
+const RedisAddrEnv = "AXIS_TEST_REDIS_ADDR"
+
+func TestEscapeString(t *testing.T) {
+	tests := []struct {
+		Unescaped string
+		Escaped   string
+	}{
+		{"helloworld", "helloworld"},
+		{"hello world", `hello\ world`},
+		{"Hello, World! (v1.0)", `Hello\,\ World\!\ \(v1\.0\)`},
+		{"a:b,c", `a\:b\,c`},
+		{"user@example.com", `user\@example\.com`},
+		{"{[<$%^&*+=~>]}", `\{\[\<\$\%\^\&\*\+\=\~\>\]\}`},
+		{`'"-;#`, `\'\"\-\;\#`},
+	}
+	for _, test := range tests {
+		actual := escapeString(test.Unescaped)
+		require.Equal(t, test.Escaped, actual)
+		require.Equal(t, test.Unescaped, unescapeString(actual))
+	}
+}
+
+func TestRedisFindQuery(t *testing.T) {
+	tests := []struct {
+		Owner    string // defaults to AllOwners
+		Cids     []string
+		Statuses []string
+		Name     string
+		Before   int64
+		After    int64
+		Match    string
+		Meta     models.Info
+		Expected string
+	}{
+		{Expected: "*"},
+		{Owner: "user@example.com", Expected: `@owner:{user\@example\.com}`},
+		{
+			Cids:     []string{"abc123", "def456"},
+			Statuses: []string{"queued", "pinning"},
+			Expected: "@cid:(abc123|def456) @status:(queued|pinning)",
+		},
+		{Name: "hello", Expected: "@name:hello"},
+		{
+			Name:     "Hello, World",
+			Match:    "exact",
+			Expected: "@name_exact:{48656c6c6f2c20576f726c64}",
+		},
+		{
+			Name:     "Hello, World",
+			Match:    "iexact",
+			Expected: `@name:(Hello\,\ World)`,
+		},
+		{Name: "hello", Match: "partial", Expected: "@name:(*hello*)"},
+		{Name: "hello", Match: "ipartial", Expected: "@name:(*hello*)"},
+		{After: 1621000000, Expected: "@created:[(1621000000 +inf]"},
+		{Before: 1621000000, Expected: "@created:[-inf (1621000000]"},
+		{
+			Before:   1621000002,
+			After:    1621000001,
+			Expected: "@created:[(1621000001 (1621000002]",
+		},
+		{
+			Meta:     models.Info{"a,b": "c:d"},
+			Expected: `@meta:{a\%2Cb\:c\%3Ad}`,
+		},
+		{
+			Meta:     models.Info{"b": "two", "a": "one"},
+			Expected: `@meta:{a\:one} @meta:{b\:two}`,
+		},
+		{
+			Owner:    "alice",
+			Statuses: []string{"pinned"},
+			Meta:     models.Info{"url": "https://example.com"},
+			Expected: `@owner:{alice} @status:(pinned) ` +
+				`@meta:{url\:https\%3A\%2F\%2Fexample\.com}`,
+		},
+	}
+	for _, test := range tests {
+		if test.Owner == "" {
+			test.Owner = AllOwners
+		}
+		actual := redisFindQuery(
+			test.Owner, test.Cids, test.Statuses, test.Name,
+			test.Before, test.After, test.Match, test.Meta,
+		)
+		require.Equal(t, test.Expected, actual)
+	}
+}
+
+func TestRedisAndQuery(t *testing.T) {
+	require.Equal(t, "@created:[1 +inf]",
+		redisAndQuery("*", "@created:[1 +inf]"))
+	require.Equal(t, "@owner:{alice} @created:[1 +inf]",
+		redisAndQuery("@owner:{alice}", "@created:[1 +inf]"))
+}
+
+func TestRedisPosition(t *testing.T) {
+	// positions sort by creation, and then ID, as strings
+	require.Equal(t, "00000000001621000000:pin1",
+		redisPosition(1621000000, "pin1"))
+	require.Less(t, redisPosition(999, "b"), redisPosition(1000, "a"))
+	require.Less(t, redisPosition(1000, "a"), redisPosition(1000, "b"))
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+// PostgresDsnEnv is the environment variable holding the connection string of
+// the PostgreSQL database used by the integration tests; the database's pins
+// are dropped. If unset, an embedded PostgreSQL server is started for the
+// tests; they are skipped if it fails to start, or when testing in short mode.
+const PostgresDsnEnv = "AXIS_TEST_POSTGRES_DSN"
+
+// postgresEmbeddedPort is the port of the embedded PostgreSQL server; it is
+// not the default port, so as to not collide with a local server.
+const postgresEmbeddedPort = 15432
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	os.Exit(runWithPostgres(m))
+}
+
+// runWithPostgres runs the tests, starting an embedded PostgreSQL server, and
+// setting PostgresDsnEnv to its connection string, if no database is set. If
+// the server fails to start, the tests are run without it, and those needing a
+// database are skipped. Returns the exit code of the tests.
+func runWithPostgres(m *testing.M) int {
+	if os.Getenv(PostgresDsnEnv) != "" || testing.Short() {
+		return m.Run()
+	}
+	dir, err := os.MkdirTemp("", "axis-postgres")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create PostgreSQL directory: %s\n", err)
+		return m.Run()
+	}
+	defer os.RemoveAll(dir)
+	cfg := embeddedpostgres.DefaultConfig().
+		Version(embeddedpostgres.V14).
+		Port(postgresEmbeddedPort).
+		RuntimePath(dir).
+		Logger(io.Discard)
+	server := embeddedpostgres.NewDatabase(cfg)
+	if err := server.Start(); err != nil {
+		fmt.Fprintf(os.Stderr,
+			"failed to start embedded PostgreSQL (set %s to test "+
+				"against a database): %s\n", PostgresDsnEnv, err)
+		return m.Run()
+	}
+	defer server.Stop()
+	os.Setenv(PostgresDsnEnv, cfg.GetConnectionURL()+"?sslmode=disable")
+	return m.Run()
+}
+
+func TestPostgresFindFilter(t *testing.T) {
+	tests := []struct {
+		Owner    string // defaults to AllOwners
+		Cids     []string
+		Statuses []string
+		Name     string
+		Before   int64
+		After    int64
+		Match    string
+		Cursor   *Cursor
+		SortBy   *SortingKey
+		Meta     models.Info
+		Where    string
+		Args     []interface{}
+	}{
+		{Where: "", Args: []interface{}{}},
+		{
+			Owner:    "alice",
+			Cids:     []string{"abc123", "def456"},
+			Statuses: []string{"queued"},
+			Where:    " WHERE owner = $1 AND cid = ANY($2) AND status = ANY($3)",
+			Args: []interface{}{
+				"alice",
+				pq.Array([]string{"abc123", "def456"}),
+				pq.Array([]string{"queued"}),
+			},
+		},
+		{
+			Name:  "Hello, World",
+			Match: "exact",
+			Where: " WHERE name = $1",
+			Args:  []interface{}{"Hello, World"},
+		},
+		{
+			Name:  "hello",
+			Match: "iexact",
+			Where: " WHERE lower(name) = lower($1)",
+			Args:  []interface{}{"hello"},
+		},
+		{
+			Name:  "hello",
+			Match: "partial",
+			Where: " WHERE strpos(name, $1) > 0",
+			Args:  []interface{}{"hello"},
+		},
+		{
+			Name:  "hello",
+			Match: "ipartial",
+			Where: " WHERE strpos(lower(name), lower($1)) > 0",
+			Args:  []interface{}{"hello"},
+		},
+		{
+			Before: 1621000003,
+			After:  1621000001,
+			Meta:   models.Info{"app": "a:b,c"},
+			Where:  " WHERE created < $1 AND created > $2 AND meta @> $3::jsonb",
+			Args: []interface{}{
+				int64(1621000003),
+				int64(1621000001),
+				`{"app":"a:b,c"}`,
+			},
+		},
+		{
+			Owner:  "alice",
+			Cursor: &Cursor{Created: 1621000001, Id: "pin1"},
+			SortBy: &SortingKey{Field: "created", Ascending: true},
+			Where:  " WHERE owner = $1 AND (created, id) > ($2, $3)",
+			Args:   []interface{}{"alice", int64(1621000001), "pin1"},
+		},
+		{
+			Cursor: &Cursor{Created: 1621000001, Id: "pin1"},
+			SortBy: &SortingKey{Field: "created", Ascending: false},
+			Where:  " WHERE (created, id) < ($1, $2)",
+			Args:   []interface{}{int64(1621000001), "pin1"},
+		},
+	}
+	for i, test := range tests {
+		if test.Owner == "" {
+			test.Owner = AllOwners
+		}
+		where, args, err := postgresFindFilter(
+			test.Owner, test.Cids, test.Statuses, test.Name,
+			test.Before, test.After, test.Match, test.Cursor,
+			test.SortBy, test.Meta,
+		)
+		require.Nil(t, err, i)
+		require.Equal(t, test.Where, where, i)
+		require.Equal(t, test.Args, args, i)
+	}
+}
+
+func TestPostgresOrderBy(t *testing.T) {
+	orderBy, err := postgresOrderBy(nil)
+	require.Nil(t, err)
+	require.Equal(t, " ORDER BY id", orderBy)
+	orderBy, err = postgresOrderBy(&SortingKey{Field: "created", Ascending: true})
+	require.Nil(t, err)
+	require.Equal(t, " ORDER BY created ASC, id ASC", orderBy)
+	orderBy, err = postgresOrderBy(&SortingKey{Field: "name"})
+	require.Nil(t, err)
+	require.Equal(t, " ORDER BY name DESC, id DESC", orderBy)
+	_, err = postgresOrderBy(&SortingKey{Field: "name; DROP TABLE pins"})
+	require.NotNil(t, err)
+}
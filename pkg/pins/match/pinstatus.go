@@ -17,7 +17,7 @@ func PinStatus(pin models.Pin) gomock.Matcher {
 func (ps *pinStatus) Matches(x interface{}) bool {
 	ps2, ok := x.(models.PinStatus)
 	if ok {
-		return ps2.Status == models.StatusInit.String() &&
+		return ps2.Status == models.StatusQueued.String() &&
 			reflect.DeepEqual(ps.inner.Pin, ps2.Pin)
 	}
 	return false
@@ -0,0 +1,45 @@
+package match
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+type statusPatch struct{ inner map[string]interface{} }
+
+// StatusPatch returns a matcher of the fields patched for a pin's status. The
+// time of the status check is expected in the patched info, but its value is
+// only required to be an RFC 3339 timestamp.
+func StatusPatch(fields map[string]interface{}) gomock.Matcher {
+	return &statusPatch{fields}
+}
+
+func (sp *statusPatch) Matches(x interface{}) bool {
+	fields, ok := x.(map[string]interface{})
+	if !ok || fields["status"] != sp.inner["status"] {
+		return false
+	}
+	info, ok := fields["info"].(models.Info)
+	if !ok {
+		return false
+	}
+	if _, err := time.Parse(time.RFC3339, info["last_check"]); err != nil {
+		return false
+	}
+	actual := models.Info{}
+	for k, v := range info {
+		if k != "last_check" {
+			actual[k] = v
+		}
+	}
+	return reflect.DeepEqual(sp.inner["info"], actual)
+}
+
+func (sp *statusPatch) String() string {
+	return fmt.Sprintf("is a status patch of %v", sp.inner)
+}
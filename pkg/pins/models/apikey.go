@@ -0,0 +1,20 @@
+package models
+
+// ApiKey represents a long-lived bearer token of a user. Only the hash of the
+// key is stored; the key itself is returned once, when issued.
+type ApiKey struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Prefix  string   `json:"prefix"` // leading characters of the key
+	Created string   `json:"created"`
+	Key     string   `json:"key,omitempty"`    // set only when issued
+	Scopes  []string `json:"scopes,omitempty"` // scopes of the issuing token
+	Hash    string   `json:"-"`
+	Owner   string   `json:"-"`
+	Grant   string   `json:"-"` // grant of the token the key was issued by
+}
+
+type ApiKeys struct {
+	Count   int      `json:"count"`
+	Results []ApiKey `json:"results"`
+}
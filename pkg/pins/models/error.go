@@ -17,6 +17,10 @@ const (
 	ErrUnauthorizedCode
 	ErrProcessingRequestCode
 	ErrNotFoundCode
+	ErrInvalidCursorCode
+	ErrForbiddenCode
+	ErrInsufficientFundsCode
+	ErrConflictCode
 )
 
 var ErrorCodeStrings = map[int]string{
@@ -31,19 +35,25 @@ var ErrorCodeStrings = map[int]string{
 	ErrUnauthorizedCode:           "UNAUTHORIZED",
 	ErrProcessingRequestCode:      "PROCESSING_REQUEST",
 	ErrNotFoundCode:               "NOT_FOUND",
+	ErrInvalidCursorCode:          "INVALID_CURSOR",
+	ErrForbiddenCode:              "FORBIDDEN",
+	ErrInsufficientFundsCode:      "INSUFFICIENT_FUNDS",
+	ErrConflictCode:               "CONFLICT",
 }
 
+// Error represents the reason, and optional details, of a failed request
 type Error struct {
-	Reason  string
-	Details string
+	Reason  string `json:"reason"`
+	Details string `json:"details,omitempty"`
 }
 
 func (err Error) Error() string {
 	return fmt.Sprintf("%s: %s", err.Reason, err.Details)
 }
 
+// Failure represents the response body of a failed request
 type Failure struct {
-	Error Error
+	Error Error `json:"error"`
 }
 
 func NewFailure(reasonCode int, details string) Failure {
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -29,3 +30,23 @@ func TestNewFailure(t *testing.T) {
 	actual := NewFailure(reasonCode, details)
 	require.Equal(t, expected, actual)
 }
+
+func TestFailureJson(t *testing.T) {
+	b, err := json.Marshal(NewFailure(ErrNotFoundCode, "pin not found"))
+	require.Nil(t, err)
+	require.JSONEq(
+		t,
+		`{"error":{"reason":"NOT_FOUND","details":"pin not found"}}`,
+		string(b),
+	)
+	b, err = json.Marshal(NewFailure(ErrInsufficientFundsCode, ""))
+	require.Nil(t, err)
+	require.JSONEq(t, `{"error":{"reason":"INSUFFICIENT_FUNDS"}}`, string(b))
+}
+
+func TestErrorCodeStrings(t *testing.T) {
+	// every error code has a reason
+	for code := ErrMaxPinLimitCode; code <= ErrConflictCode; code++ {
+		require.NotEmpty(t, ErrorCodeStrings[code], code)
+	}
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"net/url"
 	"sort"
 	"strings"
 )
@@ -26,23 +27,42 @@ func (i Info) Keys() []string {
 	return keys
 }
 
+// String returns the Info as a comma separated list of key-value pairs
+// (E.g. "a:one,b:two"). Keys and values are query escaped, such that any
+// string, including those containing commas or colons, is encoded losslessly.
 func (i Info) String() string {
 	var ss []string
 	keys := i.Keys()
 	for _, k := range keys {
-		ss = append(ss, fmt.Sprintf("%s:%s", k, i[k]))
+		ss = append(ss, fmt.Sprintf(
+			"%s:%s",
+			url.QueryEscape(k),
+			url.QueryEscape(i[k]),
+		))
 	}
 	return strings.Join(ss, ",")
 }
 
+// InfoFromString returns the Info for the given string as encoded by
+// Info.String. Pairs that cannot be decoded are skipped.
 func InfoFromString(s string) Info {
 	info := make(Info)
 	pairs := strings.Split(s, ",")
 	for _, kv := range pairs {
+		// colons are escaped, so a pair holds a single unescaped colon
 		parts := strings.Split(kv, ":")
-		if len(parts) == 2 {
-			info[parts[0]] = parts[1]
+		if len(parts) != 2 {
+			continue
 		}
+		k, err := url.QueryUnescape(parts[0])
+		if err != nil {
+			continue
+		}
+		v, err := url.QueryUnescape(parts[1])
+		if err != nil {
+			continue
+		}
+		info[k] = v
 	}
 	return info
 }
@@ -61,10 +81,39 @@ type PinStatus struct {
 	Pin       Pin      `json:"pin"`
 	Delegates []string `json:"delegates"`
 	Info      Info     `json:"info"`
+	Owner     string   `json:"-"`
+}
+
+// PinRecord represents a PinStatus and its owner, as exported from, and
+// imported into, the Pins database. An export that fails after writing records
+// ends with a record holding only the error, as a Failure, so that it is not
+// taken for a complete export.
+type PinRecord struct {
+	PinStatus
+	Owner string `json:"owner"`
+	Error *Error `json:"error,omitempty"`
+}
+
+// NewPinRecord returns the PinRecord for the given PinStatus
+func NewPinRecord(ps PinStatus) PinRecord {
+	return PinRecord{PinStatus: ps, Owner: ps.Owner}
+}
+
+// ToPinStatus returns the record's PinStatus, owned by the record's owner
+func (r PinRecord) ToPinStatus() PinStatus {
+	ps := r.PinStatus
+	ps.Owner = r.Owner
+	return ps
+}
+
+// PinImport represents the result of importing PinRecords
+type PinImport struct {
+	Imported int `json:"imported"`
 }
 
 type Pins struct {
 	Count   int         `json:"count"`
 	Total   int         `json:"total"`
 	Results []PinStatus `json:"results"`
+	Next    string      `json:"next,omitempty"` // cursor of the next page
 }
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -15,6 +16,13 @@ func TestInfoString(t *testing.T) {
 	}
 	actual := info.String()
 	require.Equal(t, expected, actual)
+	expected = "a%3Ab:https%3A%2F%2Fexample.com%2F%3Fa%3Db%2Cc,b:one+two"
+	info = Info{
+		"a:b": "https://example.com/?a=b,c",
+		"b":   "one two",
+	}
+	actual = info.String()
+	require.Equal(t, expected, actual)
 }
 
 func TestInfoFromString(t *testing.T) {
@@ -25,4 +33,38 @@ func TestInfoFromString(t *testing.T) {
 	}
 	actual := InfoFromString("a:one,b:two,c:three")
 	require.Equal(t, expected, actual)
+	// invalid pairs are skipped
+	actual = InfoFromString("a:one,b,c:%zz,d:%2C,e:f:g")
+	require.Equal(t, Info{"a": "one", "d": ","}, actual)
+}
+
+func TestInfoFromStringRoundTrip(t *testing.T) {
+	tests := []Info{
+		{},
+		{"a": "one"},
+		{"a": "one", "b": "two"},
+		{"time": "12:30", "url": "https://example.com/?a=b,c"},
+		{"json": `{"a": [1, 2], "b": "c:d"}`},
+		{"a,b:c": "%2C+ "},
+		{"empty": ""},
+	}
+	for _, info := range tests {
+		require.Equal(t, info, InfoFromString(info.String()))
+	}
+}
+
+func TestPinRecord(t *testing.T) {
+	ps := PinStatus{
+		Id:      "thispinsid",
+		Status:  "pinned",
+		Created: "1621000000",
+		Pin:     Pin{Cid: "abc123", Name: "helloworld"},
+		Owner:   "myuserid",
+	}
+	b, err := json.Marshal(NewPinRecord(ps))
+	require.Nil(t, err)
+	require.Contains(t, string(b), `"owner":"myuserid"`)
+	var rec PinRecord
+	require.Nil(t, json.Unmarshal(b, &rec))
+	require.Equal(t, ps, rec.ToPinStatus())
 }
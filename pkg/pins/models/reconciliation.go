@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Reconciliation represents the outcome of a reconciliation between the pins
+// database and the IPFS cluster's pinset.
+type Reconciliation struct {
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Checked   int       `json:"checked"`   // number of pins checked
+	Corrected []string  `json:"corrected"` // IDs of pins with a corrected status
+	Repinned  []string  `json:"repinned"`  // IDs of pins re-issued to the cluster
+	Orphaned  []string  `json:"orphaned"`  // CIDs pinned without a pin request
+	Errors    []string  `json:"errors"`
+}
@@ -14,6 +14,7 @@ const (
 	StatusUnpinning
 	StatusUnpinned
 	StatusError
+	StatusFailed
 	StatusUndefined
 )
 
@@ -29,6 +30,7 @@ var StatusStrings = []string{
 	"unpinning",
 	"unpinned",
 	"error",
+	"failed",
 	"undefined",
 }
 
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TimeLayout is the layout of timestamps; RFC 3339 with millisecond precision
+const TimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// FormatTime returns the timestamp of the given time in UTC.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeLayout)
+}
+
+// ParseTime returns the time of the given RFC 3339 timestamp. If unix is set,
+// Unix timestamps, in seconds, are accepted for compatibility with existing
+// clients.
+func ParseTime(s string, unix bool) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err == nil {
+		return t, nil
+	}
+	if unix {
+		if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return time.Unix(sec, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp ('%s')", s)
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatTime(t *testing.T) {
+	tm := time.Date(2021, 5, 14, 15, 46, 40, 123456789, time.FixedZone("", 7200))
+	require.Equal(t, "2021-05-14T13:46:40.123Z", FormatTime(tm))
+	require.Equal(t, "2021-05-14T13:46:40.000Z", FormatTime(time.Unix(1621000000, 0)))
+}
+
+func TestParseTime(t *testing.T) {
+	expected := time.UnixMilli(1621000000123)
+	for _, s := range []string{
+		"2021-05-14T13:46:40.123Z",
+		"2021-05-14T15:46:40.123+02:00",
+		"2021-05-14T13:46:40.123456Z",
+	} {
+		actual, err := ParseTime(s, false)
+		require.Nil(t, err, s)
+		require.Equal(t, expected.UnixMilli(), actual.UnixMilli(), s)
+	}
+	actual, err := ParseTime("1621000000", true)
+	require.Nil(t, err)
+	require.Equal(t, int64(1621000000), actual.Unix())
+	for _, s := range []string{"1621000000", "", "2021-05-14", "yesterday"} {
+		_, err = ParseTime(s, false)
+		require.NotNil(t, err, s)
+	}
+}
@@ -2,68 +2,343 @@ package pinwatcher
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/crossedbot/common/golang/logger"
 	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
 	cluster "github.com/ipfs-cluster/ipfs-cluster/api/rest/client"
+	ipfscid "github.com/ipfs/go-cid"
 
+	"github.com/crossedbot/axis/pkg/pinner"
 	pinsdb "github.com/crossedbot/axis/pkg/pins/database"
 	"github.com/crossedbot/axis/pkg/pins/models"
 )
 
+const (
+	// DefaultCheckFrequency is the default frequency at which the statuses
+	// of the tracked pins are checked
+	DefaultCheckFrequency = 1 * time.Minute
+
+	// DefaultWorkers is the default number of workers updating the pins
+	// database with the statuses returned by the cluster
+	DefaultWorkers = 8
+
+	// DefaultBatchSize is the default maximum number of CIDs for which the
+	// status is requested from the cluster in a single call
+	DefaultBatchSize = 100
+
+	// restorePageSize is the number of pins retrieved per query when
+	// restoring the watcher's registrations
+	restorePageSize = 1000
+)
+
+// RestoreStatuses is the list of non-terminal pin statuses. Pins in one of
+// these statuses are still expected to reach the pinned status and are tracked
+// again when the watcher is restored.
+var RestoreStatuses = []string{
+	models.StatusInit.String(),
+	models.StatusQueued.String(),
+	models.StatusPinQueued.String(),
+	models.StatusPinning.String(),
+}
+
+// PinWatcher tracks the statuses of pins in the IPFS cluster. Registrations
+// are persisted by the pins' statuses in the pins database; any pin in a
+// non-terminal status is expected to be tracked.
 type PinWatcher interface {
+	// Register starts tracking the status of the given pin. If set, onTarget
+	// is called once the pin reaches its target status.
 	Register(
 		p models.PinStatus,
 		targetStatus clusterapi.TrackerStatus,
-		checkFreq time.Duration,
+		onTarget func(p models.PinStatus),
 	)
+	// Deregister stops tracking the status of the pin for the given ID
 	Deregister(pid string)
+	// Restore registers all pins in a non-terminal status that are not
+	// already tracked. This is intended for resuming the tracking of pins
+	// after the service restarts. If set, onTarget is called once a
+	// restored pin reaches its target status.
+	Restore(onTarget func(p models.PinStatus)) error
 }
 
+// registration represents a pin tracked by the watcher
+type registration struct {
+	pin      models.PinStatus
+	cid      string // the pin's CID in its canonical string form
+	target   clusterapi.TrackerStatus
+	onTarget func(p models.PinStatus)
+}
+
+// pinWatcher implements the PinWatcher interface. Rather than tracking each pin
+// individually, the statuses of all tracked pins are requested from the
+// cluster in batches at every check, and the results are fanned out to a
+// bounded pool of workers that update the pins database.
 type pinWatcher struct {
 	*sync.Mutex
-	ctx            context.Context
-	client         cluster.Client
-	db             pinsdb.Pins
-	statusTrackers []StatusTracker
+	ctx           context.Context
+	client        cluster.Client
+	db            pinsdb.Pins
+	checkFreq     time.Duration
+	workers       int
+	batchSize     int
+	policy        pinner.StatusPolicy
+	registrations map[string]*registration            // keyed by pin ID
+	byCid         map[string]map[string]*registration // keyed by CID, pin ID
 }
 
+// New returns a new PinWatcher that checks the statuses of its tracked pins at
+// the given frequency, using the given number of workers to update the pins
+// database. Non-positive values are replaced by their defaults. A pin's status
+// is agreed upon by the cluster peers per the given policy. The watcher runs
+// until the given context is done.
 func New(
 	ctx context.Context,
 	client cluster.Client,
 	db pinsdb.Pins,
+	checkFreq time.Duration,
+	workers int,
+	policy pinner.StatusPolicy,
 ) PinWatcher {
-	return &pinWatcher{
-		Mutex:  new(sync.Mutex),
-		ctx:    ctx,
-		client: client,
-		db:     db,
+	if checkFreq <= 0 {
+		checkFreq = DefaultCheckFrequency
+	}
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	w := &pinWatcher{
+		Mutex:         new(sync.Mutex),
+		ctx:           ctx,
+		client:        client,
+		db:            db,
+		checkFreq:     checkFreq,
+		workers:       workers,
+		batchSize:     DefaultBatchSize,
+		policy:        policy,
+		registrations: make(map[string]*registration),
+		byCid:         make(map[string]map[string]*registration),
 	}
+	go w.run()
+	return w
 }
 
 func (w *pinWatcher) Register(
 	p models.PinStatus,
 	target clusterapi.TrackerStatus,
-	checkFreq time.Duration,
+	onTarget func(p models.PinStatus),
 ) {
 	w.Lock()
 	defer w.Unlock()
-	statusTracker := NewStatusTracker(w.ctx, w.client, w.db, p)
-	go statusTracker.Poll(target, checkFreq)
-	w.statusTrackers = append(w.statusTrackers, statusTracker)
+	if _, ok := w.registrations[p.Id]; ok {
+		return
+	}
+	cid, err := ipfscid.Decode(p.Pin.Cid)
+	if err != nil {
+		logger.Error(fmt.Sprintf(
+			"Failed to decode pin's CID: %s",
+			err,
+		))
+		return
+	}
+	reg := &registration{
+		pin:      p,
+		cid:      cid.String(),
+		target:   target,
+		onTarget: onTarget,
+	}
+	w.registrations[p.Id] = reg
+	if w.byCid[reg.cid] == nil {
+		w.byCid[reg.cid] = make(map[string]*registration)
+	}
+	w.byCid[reg.cid][p.Id] = reg
 }
 
 func (w *pinWatcher) Deregister(pid string) {
 	w.Lock()
 	defer w.Unlock()
-	for i, st := range w.statusTrackers {
-		if pid == st.GetId() {
-			st.Stop()
-			w.statusTrackers[i] =
-				w.statusTrackers[len(w.statusTrackers)-1]
-			w.statusTrackers =
-				w.statusTrackers[:len(w.statusTrackers)-1]
+	reg, ok := w.registrations[pid]
+	if !ok {
+		return
+	}
+	delete(w.registrations, pid)
+	delete(w.byCid[reg.cid], pid)
+	if len(w.byCid[reg.cid]) == 0 {
+		delete(w.byCid, reg.cid)
+	}
+}
+
+func (w *pinWatcher) Restore(onTarget func(p models.PinStatus)) error {
+	// collect the pins before registering them; registered pins may change
+	// status while paging through the results
+	pending := []models.PinStatus{}
+	var cursor *pinsdb.Cursor
+	for {
+		pins, err := w.db.Find(
+			pinsdb.AllOwners, nil, RestoreStatuses, "", 0, 0, "",
+			restorePageSize, 0, cursor, nil, nil,
+		)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, pins.Results...)
+		if len(pins.Results) < restorePageSize {
+			break
+		}
+		next, err := pinsdb.NewCursor(pins.Results[len(pins.Results)-1])
+		if err != nil {
+			return err
+		}
+		cursor = &next
+	}
+	for _, p := range pending {
+		w.Register(p, clusterapi.TrackerStatusPinned, onTarget)
+	}
+	if len(pending) > 0 {
+		logger.Info(fmt.Sprintf(
+			"Pin Watcher: restored tracking of %d pin(s)",
+			len(pending),
+		))
+	}
+	return nil
+}
+
+// run checks the statuses of the tracked pins at the watcher's frequency until
+// its context is done.
+func (w *pinWatcher) run() {
+	ticker := time.NewTicker(w.checkFreq)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			w.check()
 		}
 	}
 }
+
+// check requests the statuses of all tracked pins from the cluster, in batches
+// of CIDs, and updates the tracked pins with the results.
+func (w *pinWatcher) check() {
+	cids := w.trackedCids()
+	for start := 0; start < len(cids); start += w.batchSize {
+		end := start + w.batchSize
+		if end > len(cids) {
+			end = len(cids)
+		}
+		w.checkBatch(cids[start:end])
+	}
+}
+
+// checkBatch requests the statuses of the given CIDs from the cluster and fans
+// the results out to the watcher's workers.
+func (w *pinWatcher) checkBatch(cids []clusterapi.Cid) {
+	out := make(chan clusterapi.GlobalPinInfo, len(cids))
+	var wg sync.WaitGroup
+	for i := 0; i < w.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for gblPinInfo := range out {
+				w.update(gblPinInfo)
+			}
+		}()
+	}
+	// the client closes the output channel once done
+	err := w.client.StatusCids(w.ctx, cids, false, out)
+	wg.Wait()
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get statuses: %s", err))
+	}
+}
+
+// update patches the pins tracked for the CID of the given status, and
+// deregisters the pins that have reached their target status.
+func (w *pinWatcher) update(gblPinInfo clusterapi.GlobalPinInfo) {
+	checked := time.Now()
+	dagSize := ""
+	for _, reg := range w.registered(gblPinInfo.Cid.String()) {
+		fields, _ := StatusPatch(reg.pin, gblPinInfo, w.policy, checked)
+		if fields == nil {
+			// no status has been reported
+			return
+		}
+		info := fields["info"].(models.Info)
+		if fields["status"] == models.StatusPinned.String() &&
+			info[InfoDagSize] == "" {
+			if dagSize == "" {
+				dagSize = w.dagSize(gblPinInfo.Cid)
+			}
+			if dagSize != "" {
+				info[InfoDagSize] = dagSize
+			}
+		}
+		err := w.db.Patch(reg.pin.Id, fields)
+		if err == pinsdb.ErrNotFound {
+			// the pin has been removed
+			w.Deregister(reg.pin.Id)
+			continue
+		} else if err != nil {
+			logger.Error(fmt.Sprintf(
+				"Failed to patch pin's status: %s",
+				err,
+			))
+			continue
+		}
+		// only this worker updates the registration's pin
+		reg.pin.Status = fields["status"].(string)
+		reg.pin.Info = info
+		if info[pinner.InfoClusterStatus] == reg.target.String() {
+			w.Deregister(reg.pin.Id)
+			if reg.onTarget != nil {
+				reg.onTarget(reg.pin)
+			}
+		}
+	}
+}
+
+// dagSize returns the cumulative size, in bytes, of the DAG of the given CID
+// as reported by the cluster's IPFS proxy. Returns an empty string if the size
+// cannot be determined.
+func (w *pinWatcher) dagSize(cid clusterapi.Cid) string {
+	sh := w.client.IPFS(w.ctx)
+	if sh == nil {
+		return ""
+	}
+	stat, err := sh.FilesStat(w.ctx, "/ipfs/"+cid.String())
+	if err != nil {
+		logger.Error(fmt.Sprintf(
+			"Failed to get DAG size of CID ('%s'): %s",
+			cid, err,
+		))
+		return ""
+	}
+	return strconv.FormatUint(stat.CumulativeSize, 10)
+}
+
+// trackedCids returns the unique list of CIDs of the tracked pins.
+func (w *pinWatcher) trackedCids() []clusterapi.Cid {
+	w.Lock()
+	defer w.Unlock()
+	cids := []clusterapi.Cid{}
+	for s := range w.byCid {
+		// registered CIDs have already been decoded successfully
+		cid, _ := ipfscid.Decode(s)
+		cids = append(cids, clusterapi.NewCid(cid))
+	}
+	return cids
+}
+
+// registered returns the registrations of the tracked pins for the given CID.
+func (w *pinWatcher) registered(cid string) []*registration {
+	w.Lock()
+	defer w.Unlock()
+	regs := []*registration{}
+	for _, reg := range w.byCid[cid] {
+		regs = append(regs, reg)
+	}
+	return regs
+}
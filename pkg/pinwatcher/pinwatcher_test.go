@@ -2,19 +2,61 @@ package pinwatcher
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"sync"
 	"testing"
-	"time"
 
 	"github.com/golang/mock/gomock"
 	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
 	ipfscid "github.com/ipfs/go-cid"
+	shell "github.com/ipfs/go-ipfs-api"
 	"github.com/stretchr/testify/require"
 
 	"github.com/crossedbot/axis/pkg/mocks"
+	"github.com/crossedbot/axis/pkg/pinner"
+	pinsdb "github.com/crossedbot/axis/pkg/pins/database"
+	"github.com/crossedbot/axis/pkg/pins/match"
 	"github.com/crossedbot/axis/pkg/pins/models"
 )
 
+func newTestPinWatcher(ctx context.Context, client *mocks.MockClient, db *mocks.MockPins) *pinWatcher {
+	return &pinWatcher{
+		Mutex:         new(sync.Mutex),
+		ctx:           ctx,
+		client:        client,
+		db:            db,
+		workers:       DefaultWorkers,
+		batchSize:     DefaultBatchSize,
+		policy:        pinner.DefaultStatusPolicy,
+		registrations: make(map[string]*registration),
+		byCid:         make(map[string]map[string]*registration),
+	}
+}
+
+// statusCids returns a function, for mocking the cluster client's StatusCids,
+// that reports the given status for every requested CID.
+func statusCids(status clusterapi.TrackerStatus) interface{} {
+	return func(
+		_ context.Context,
+		cids []clusterapi.Cid,
+		_ bool,
+		out chan<- clusterapi.GlobalPinInfo,
+	) error {
+		defer close(out)
+		for _, cid := range cids {
+			out <- clusterapi.GlobalPinInfo{
+				Cid: cid,
+				PeerMap: map[string]clusterapi.PinInfoShort{
+					"peer": clusterapi.PinInfoShort{Status: status},
+				},
+			}
+		}
+		return nil
+	}
+}
+
 func TestPinWatcherRegister(t *testing.T) {
 	ctx := context.Background()
 	pinStatus := models.PinStatus{
@@ -34,50 +76,133 @@ func TestPinWatcherRegister(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockDb := mocks.NewMockPins(mockCtrl)
 	mockIpfsClient := mocks.NewMockClient(mockCtrl)
-	mockDb.EXPECT().
-		Get(pinStatus.Id).
-		Return(pinStatus, nil)
 	mockIpfsClient.EXPECT().
-		Status(ctx, clusterapi.NewCid(cid), true).
-		Return(clusterapi.GlobalPinInfo{
-			PeerMap: map[string]clusterapi.PinInfoShort{
-				"peer": clusterapi.PinInfoShort{
-					Status: clusterapi.TrackerStatusPinned,
-				},
-			},
-		}, nil)
+		StatusCids(ctx, []clusterapi.Cid{clusterapi.NewCid(cid)}, false, gomock.Any()).
+		DoAndReturn(statusCids(clusterapi.TrackerStatusPinned))
+	// the DAG size is retrieved from the cluster's IPFS proxy once pinned
+	ipfs := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/api/v0/files/stat", r.URL.Path)
+			require.Equal(t, "/ipfs/"+pinStatus.Pin.Cid, r.URL.Query().Get("arg"))
+			fmt.Fprint(w, `{"CumulativeSize": 1234}`)
+		},
+	))
+	defer ipfs.Close()
+	mockIpfsClient.EXPECT().
+		IPFS(ctx).
+		Return(shell.NewShell(ipfs.URL))
 	mockDb.EXPECT().
-		Patch(pinStatus.Id, map[string]interface{}{"status": "pinned"}).
+		Patch(pinStatus.Id, match.StatusPatch(map[string]interface{}{
+			"status": "pinned",
+			"info": models.Info{
+				"cluster_status":   "pinned",
+				"peer_status.peer": "pinned",
+				"dag_size":         "1234",
+			},
+		})).
 		Return(nil)
-	pw := &pinWatcher{
-		Mutex:  new(sync.Mutex),
-		ctx:    ctx,
-		client: mockIpfsClient,
-		db:     mockDb,
-	}
+	pw := newTestPinWatcher(ctx, mockIpfsClient, mockDb)
+	var reached models.PinStatus
 	pw.Register(
 		pinStatus,
 		clusterapi.TrackerStatusPinned,
-		10*time.Millisecond,
+		func(p models.PinStatus) { reached = p },
 	)
-	// Sleep since the Register call will create a go routine to poll the
-	// pin's status
-	time.Sleep(100 * time.Millisecond)
+	pw.check()
+	require.Equal(t, pinStatus.Id, reached.Id)
+	require.Equal(t, "pinned", reached.Status)
+	// the pin has reached its target and is no longer tracked
+	require.Empty(t, pw.registrations)
+	require.Empty(t, pw.byCid)
 }
 
 func TestPinWatcherDeregister(t *testing.T) {
-	pid := "thispinsid"
+	pinStatus := models.PinStatus{
+		Id: "thispinsid",
+		Pin: models.Pin{
+			Cid: "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv",
+		},
+	}
+	pw := newTestPinWatcher(context.Background(), nil, nil)
+	pw.Register(pinStatus, clusterapi.TrackerStatusPinned, nil)
+	require.Len(t, pw.registrations, 1)
+	require.Len(t, pw.byCid, 1)
+	pw.Deregister(pinStatus.Id)
+	require.Empty(t, pw.registrations)
+	require.Empty(t, pw.byCid)
+}
+
+func TestPinWatcherRestore(t *testing.T) {
+	ctx := context.Background()
+	pinStatus := models.PinStatus{
+		Id:      "thispinsid",
+		Status:  "pinning",
+		Created: "1621000000",
+		Pin: models.Pin{
+			Cid:  "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv",
+			Name: "helloworld",
+		},
+	}
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
-	mockStatusTracker := mocks.NewMockStatusTracker(mockCtrl)
-	mockStatusTracker.EXPECT().
-		GetId().
-		Return(pid)
-	mockStatusTracker.EXPECT().
-		Stop()
-	pw := &pinWatcher{
-		Mutex:          new(sync.Mutex),
-		statusTrackers: []StatusTracker{mockStatusTracker},
+	mockDb := mocks.NewMockPins(mockCtrl)
+	mockDb.EXPECT().
+		Find(
+			pinsdb.AllOwners, nil, RestoreStatuses, "", int64(0),
+			int64(0), "",
+			restorePageSize, 0, nil, nil, nil,
+		).
+		Return(models.Pins{
+			Count:   1,
+			Total:   1,
+			Results: []models.PinStatus{pinStatus},
+		}, nil)
+	pw := newTestPinWatcher(ctx, nil, mockDb)
+	retired := false
+	require.Nil(t, pw.Restore(func(models.PinStatus) { retired = true }))
+	require.Contains(t, pw.registrations, pinStatus.Id)
+	// restored pins are given the callback
+	pw.registrations[pinStatus.Id].onTarget(pinStatus)
+	require.True(t, retired)
+}
+
+// benchmarkPinWatcherCheck measures a single status check over the given
+// number of tracked pins. The pins stay pinning, so only the first check
+// patches the database.
+func benchmarkPinWatcherCheck(b *testing.B, n int) {
+	ctx := context.Background()
+	mockCtrl := gomock.NewController(b)
+	defer mockCtrl.Finish()
+	mockDb := mocks.NewMockPins(mockCtrl)
+	mockDb.EXPECT().
+		Patch(gomock.Any(), gomock.Any()).
+		Return(nil).
+		AnyTimes()
+	mockIpfsClient := mocks.NewMockClient(mockCtrl)
+	mockIpfsClient.EXPECT().
+		StatusCids(ctx, gomock.Any(), false, gomock.Any()).
+		DoAndReturn(statusCids(clusterapi.TrackerStatusPinning)).
+		AnyTimes()
+	pw := newTestPinWatcher(ctx, mockIpfsClient, mockDb)
+	for i := 0; i < n; i++ {
+		cid, err := ipfscid.Prefix{
+			Version:  1,
+			Codec:    ipfscid.Raw,
+			MhType:   0x12, // sha2-256
+			MhLength: -1,
+		}.Sum([]byte(fmt.Sprintf("pin %d", i)))
+		require.Nil(b, err)
+		pw.Register(models.PinStatus{
+			Id:  fmt.Sprintf("pin%d", i),
+			Pin: models.Pin{Cid: cid.String()},
+		}, clusterapi.TrackerStatusPinned, nil)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pw.check()
 	}
-	pw.Deregister(pid)
 }
+
+func BenchmarkPinWatcherCheck100(b *testing.B)   { benchmarkPinWatcherCheck(b, 100) }
+func BenchmarkPinWatcherCheck1000(b *testing.B)  { benchmarkPinWatcherCheck(b, 1000) }
+func BenchmarkPinWatcherCheck10000(b *testing.B) { benchmarkPinWatcherCheck(b, 10000) }
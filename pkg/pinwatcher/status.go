@@ -0,0 +1,106 @@
+package pinwatcher
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
+
+	"github.com/crossedbot/axis/pkg/pinner"
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+const (
+	// InfoAllocations is the PinStatus info key holding the space separated
+	// IDs of the cluster peers allocated to the pin
+	InfoAllocations = "allocations"
+
+	// InfoDagSize is the PinStatus info key holding the cumulative size, in
+	// bytes, of the pinned DAG
+	InfoDagSize = "dag_size"
+
+	// InfoLastCheck is the PinStatus info key holding the time of the last
+	// status check (RFC 3339)
+	InfoLastCheck = "last_check"
+
+	// InfoPeerErrorPrefix prefixes the PinStatus info keys holding the error
+	// reported by a cluster peer; I.e. "peer_error.<peer ID>"
+	InfoPeerErrorPrefix = "peer_error."
+
+	// InfoPeerStatusPrefix prefixes the PinStatus info keys holding the
+	// status reported by a cluster peer; I.e. "peer_status.<peer ID>"
+	InfoPeerStatusPrefix = "peer_status."
+)
+
+// StatusPatch returns the fields to patch for the given pin to reflect the
+// given IPFS cluster status, checked at the given time. The status is agreed
+// upon by the cluster peers per the given policy, and translated to a pinning
+// service API status. The cluster's details (allocations, per-peer statuses
+// and errors, and the time of the check) are kept in the pin's info. Returns
+// false if the pin's status has not changed. No fields are returned if no peer
+// has reported a status.
+func StatusPatch(
+	ps models.PinStatus,
+	gblPinInfo clusterapi.GlobalPinInfo,
+	policy pinner.StatusPolicy,
+	checked time.Time,
+) (map[string]interface{}, bool) {
+	ts, ok := policy.TrackerStatus(gblPinInfo)
+	if !ok {
+		return nil, false
+	}
+	status := pinner.StatusFromTracker(ts).String()
+	clusterStatus := ts.String()
+	changed := ps.Status != status ||
+		ps.Info[pinner.InfoClusterStatus] != clusterStatus
+
+	peers := make([]string, 0, len(gblPinInfo.PeerMap))
+	for peer := range gblPinInfo.PeerMap {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	info := models.Info{}
+	for k, v := range ps.Info {
+		// drop the details of peers that may no longer hold the pin
+		if strings.HasPrefix(k, InfoPeerStatusPrefix) ||
+			strings.HasPrefix(k, InfoPeerErrorPrefix) {
+			continue
+		}
+		info[k] = v
+	}
+	info[pinner.InfoClusterStatus] = clusterStatus
+	info[InfoLastCheck] = models.FormatTime(checked)
+	if len(gblPinInfo.Allocations) > 0 {
+		allocs := make([]string, len(gblPinInfo.Allocations))
+		for i, pid := range gblPinInfo.Allocations {
+			allocs[i] = pid.String()
+		}
+		sort.Strings(allocs)
+		info[InfoAllocations] = strings.Join(allocs, " ")
+	}
+	details := ""
+	for _, peer := range peers {
+		pinInfo := gblPinInfo.PeerMap[peer]
+		if pinInfo.Status == clusterapi.TrackerStatusRemote {
+			// the peer is not allocated to the pin
+			continue
+		}
+		info[InfoPeerStatusPrefix+peer] = pinInfo.Status.String()
+		if pinInfo.Error != "" {
+			info[InfoPeerErrorPrefix+peer] = pinInfo.Error
+			if details == "" {
+				details = pinInfo.Error
+			}
+		}
+	}
+	if status != models.StatusFailed.String() {
+		delete(info, pinner.InfoStatusDetails)
+	} else if details != "" {
+		info[pinner.InfoStatusDetails] = details
+	}
+	return map[string]interface{}{
+		"status": status,
+		"info":   info,
+	}, changed
+}
@@ -0,0 +1,84 @@
+package pinwatcher
+
+import (
+	"testing"
+	"time"
+
+	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crossedbot/axis/pkg/pinner"
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+func TestStatusPatch(t *testing.T) {
+	checked := time.Date(2021, 5, 14, 13, 46, 40, 0, time.UTC)
+	peer1, peer2 := peer.ID("peer1"), peer.ID("peer2")
+	policy := pinner.StatusPolicy{Consensus: pinner.ConsensusAll}
+	ps := models.PinStatus{
+		Id:     "thispinsid",
+		Status: "pinning",
+		Info: models.Info{
+			"a":                   "one",
+			"peer_status.oldpeer": "pinning",
+		},
+	}
+	gblPinInfo := clusterapi.GlobalPinInfo{
+		Allocations: []peer.ID{peer2, peer1},
+		PeerMap: map[string]clusterapi.PinInfoShort{
+			peer1.String(): clusterapi.PinInfoShort{
+				Status: clusterapi.TrackerStatusPinError,
+				Error:  "context deadline exceeded",
+			},
+			peer2.String(): clusterapi.PinInfoShort{
+				Status: clusterapi.TrackerStatusPinned,
+			},
+			// not allocated to the pin
+			"peer3": clusterapi.PinInfoShort{
+				Status: clusterapi.TrackerStatusRemote,
+			},
+		},
+	}
+	fields, changed := StatusPatch(ps, gblPinInfo, policy, checked)
+	require.True(t, changed)
+	require.Equal(t, map[string]interface{}{
+		"status": "failed",
+		"info": models.Info{
+			"a":                             "one",
+			"allocations":                   peer1.String() + " " + peer2.String(),
+			"cluster_status":                "pin_error",
+			"last_check":                    "2021-05-14T13:46:40.000Z",
+			"peer_error." + peer1.String():  "context deadline exceeded",
+			"peer_status." + peer1.String(): "pin_error",
+			"peer_status." + peer2.String(): "pinned",
+			"status_details":                "context deadline exceeded",
+		},
+	}, fields)
+
+	// the details of a failure are dropped once the pin recovers
+	ps.Status = "failed"
+	ps.Info = fields["info"].(models.Info)
+	gblPinInfo.PeerMap[peer1.String()] = clusterapi.PinInfoShort{
+		Status: clusterapi.TrackerStatusPinning,
+	}
+	fields, changed = StatusPatch(ps, gblPinInfo, policy, checked)
+	require.True(t, changed)
+	info := fields["info"].(models.Info)
+	require.Equal(t, "pinning", fields["status"])
+	require.Equal(t, "pinning", info["peer_status."+peer1.String()])
+	require.NotContains(t, info, "peer_error."+peer1.String())
+	require.NotContains(t, info, "status_details")
+
+	// the status is unchanged
+	ps.Status = "pinning"
+	ps.Info = info
+	_, changed = StatusPatch(ps, gblPinInfo, policy, checked)
+	require.False(t, changed)
+
+	// no status has been reported
+	fields, changed = StatusPatch(
+		ps, clusterapi.GlobalPinInfo{}, policy, checked)
+	require.Nil(t, fields)
+	require.False(t, changed)
+}
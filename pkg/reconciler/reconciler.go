@@ -0,0 +1,295 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/crossedbot/common/golang/logger"
+	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
+	cluster "github.com/ipfs-cluster/ipfs-cluster/api/rest/client"
+	ipfscid "github.com/ipfs/go-cid"
+
+	"github.com/crossedbot/axis/pkg/pinner"
+	pinsdb "github.com/crossedbot/axis/pkg/pins/database"
+	"github.com/crossedbot/axis/pkg/pins/models"
+	"github.com/crossedbot/axis/pkg/pinwatcher"
+)
+
+const (
+	// DefaultFrequency is the default frequency at which the pins database
+	// is reconciled with the cluster's pinset
+	DefaultFrequency = 10 * time.Minute
+
+	// DefaultGracePeriod is the default duration after a pin's creation
+	// during which a pin missing from the cluster's pinset is not re-issued;
+	// giving the pinner time to add it
+	DefaultGracePeriod = 5 * time.Minute
+
+	// pageSize is the number of pins retrieved per database query
+	pageSize = 1000
+)
+
+// Reconciler represents an interface to a process that detects and corrects
+// drift between the pins database and the IPFS cluster's pinset.
+type Reconciler interface {
+	// Reconcile walks all pins and the cluster's pinset, correcting pin
+	// statuses, re-issuing pins missing from the cluster, and reporting
+	// cluster pins not owned by any pin request
+	Reconcile() (models.Reconciliation, error)
+	// Run reconciles at the given frequency until the reconciler's context
+	// is done
+	Run(freq time.Duration)
+	// Last returns the summary of the last reconciliation
+	Last() models.Reconciliation
+}
+
+// reconciler implements the Reconciler interface
+type reconciler struct {
+	*sync.Mutex
+	ctx         context.Context
+	client      cluster.Client
+	db          pinsdb.Pins
+	pinner      pinner.Pinner
+	watcher     pinwatcher.PinWatcher
+	policy      pinner.StatusPolicy
+	gracePeriod time.Duration
+	last        models.Reconciliation
+}
+
+// New returns a new Reconciler for the given context, IPFS cluster client, pins
+// database, pinner, pin watcher, and status policy.
+func New(
+	ctx context.Context,
+	client cluster.Client,
+	db pinsdb.Pins,
+	p pinner.Pinner,
+	watcher pinwatcher.PinWatcher,
+	policy pinner.StatusPolicy,
+) Reconciler {
+	return &reconciler{
+		Mutex:       new(sync.Mutex),
+		ctx:         ctx,
+		client:      client,
+		db:          db,
+		pinner:      p,
+		watcher:     watcher,
+		policy:      policy,
+		gracePeriod: DefaultGracePeriod,
+	}
+}
+
+func (r *reconciler) Reconcile() (models.Reconciliation, error) {
+	r.Lock()
+	defer r.Unlock()
+	summary := models.Reconciliation{
+		Started:   time.Now(),
+		Corrected: []string{},
+		Repinned:  []string{},
+		Orphaned:  []string{},
+		Errors:    []string{},
+	}
+	pinset, err := r.pinset()
+	if err != nil {
+		return models.Reconciliation{}, err
+	}
+	statuses, err := r.statuses()
+	if err != nil {
+		return models.Reconciliation{}, err
+	}
+	owned := make(map[string]struct{})
+	var cursor *pinsdb.Cursor
+	for {
+		pins, err := r.db.Find(
+			pinsdb.AllOwners, nil, nil, "", 0, 0, "", pageSize, 0, cursor,
+			&pinsdb.SortingKey{Field: "created", Ascending: true},
+			nil,
+		)
+		if err != nil {
+			return models.Reconciliation{}, err
+		}
+		for _, ps := range pins.Results {
+			summary.Checked++
+			owned[canonicalCid(ps.Pin.Cid)] = struct{}{}
+			r.reconcilePin(ps, pinset, statuses, &summary)
+		}
+		if len(pins.Results) < pageSize {
+			break
+		}
+		next, err := pinsdb.NewCursor(pins.Results[len(pins.Results)-1])
+		if err != nil {
+			return models.Reconciliation{}, err
+		}
+		cursor = &next
+	}
+	for cid := range pinset {
+		if _, ok := owned[cid]; !ok {
+			summary.Orphaned = append(summary.Orphaned, cid)
+		}
+	}
+	summary.Finished = time.Now()
+	r.last = summary
+	return summary, nil
+}
+
+func (r *reconciler) Run(freq time.Duration) {
+	if freq <= 0 {
+		freq = DefaultFrequency
+	}
+	ticker := time.NewTicker(freq)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			summary, err := r.Reconcile()
+			if err != nil {
+				logger.Error(fmt.Sprintf(
+					"Reconciler: failed to reconcile pins: %s",
+					err,
+				))
+				continue
+			}
+			logger.Info(fmt.Sprintf(
+				"Reconciler: checked %d pin(s); corrected %d, "+
+					"re-pinned %d, found %d orphaned CID(s)",
+				summary.Checked, len(summary.Corrected),
+				len(summary.Repinned), len(summary.Orphaned),
+			))
+		}
+	}
+}
+
+func (r *reconciler) Last() models.Reconciliation {
+	r.Lock()
+	defer r.Unlock()
+	return r.last
+}
+
+// reconcilePin re-issues the given pin if it is missing from the cluster's
+// pinset, or otherwise corrects its status. Failed pins are not re-issued; a
+// pin that fails to be re-issued is marked as failed.
+func (r *reconciler) reconcilePin(
+	ps models.PinStatus,
+	pinset map[string]struct{},
+	statuses map[string]clusterapi.GlobalPinInfo,
+	summary *models.Reconciliation,
+) {
+	cid := canonicalCid(ps.Pin.Cid)
+	if _, ok := pinset[cid]; !ok {
+		if !r.graceExpired(ps) ||
+			ps.Status == models.StatusFailed.String() {
+			return
+		}
+		err := r.db.Patch(ps.Id, map[string]interface{}{
+			"status": models.StatusQueued.String(),
+		})
+		if err != nil {
+			summary.Errors = append(summary.Errors, fmt.Sprintf(
+				"failed to patch pin ('%s'): %s", ps.Id, err))
+			return
+		}
+		ps.Status = models.StatusQueued.String()
+		r.watcher.Register(ps, clusterapi.TrackerStatusPinned, nil)
+		if err := r.pinner.Add(ps.Pin); err != nil {
+			summary.Errors = append(summary.Errors, fmt.Sprintf(
+				"failed to re-pin pin ('%s'): %s", ps.Id, err))
+			r.fail(ps, err, summary)
+			return
+		}
+		summary.Repinned = append(summary.Repinned, ps.Id)
+		return
+	}
+	gblPinInfo, ok := statuses[cid]
+	if !ok {
+		return
+	}
+	fields, changed := pinwatcher.StatusPatch(
+		ps, gblPinInfo, r.policy, time.Now())
+	if fields == nil {
+		return
+	}
+	if err := r.db.Patch(ps.Id, fields); err != nil {
+		summary.Errors = append(summary.Errors, fmt.Sprintf(
+			"failed to patch pin ('%s'): %s", ps.Id, err))
+		return
+	}
+	if changed && fields["status"] != ps.Status {
+		summary.Corrected = append(summary.Corrected, ps.Id)
+	}
+}
+
+// fail stops watching the given pin and marks it as failed, recording the
+// cause in the pin's info.
+func (r *reconciler) fail(
+	ps models.PinStatus,
+	cause error,
+	summary *models.Reconciliation,
+) {
+	r.watcher.Deregister(ps.Id)
+	info := models.Info{}
+	for k, v := range ps.Info {
+		info[k] = v
+	}
+	info[pinner.InfoStatusDetails] = cause.Error()
+	err := r.db.Patch(ps.Id, map[string]interface{}{
+		"status": models.StatusFailed.String(),
+		"info":   info,
+	})
+	if err != nil {
+		summary.Errors = append(summary.Errors, fmt.Sprintf(
+			"failed to mark pin ('%s') as failed: %s", ps.Id, err))
+	}
+}
+
+// graceExpired returns true if the given pin was created before the
+// reconciler's grace period.
+func (r *reconciler) graceExpired(ps models.PinStatus) bool {
+	created, err := models.ParseTime(ps.Created, true)
+	if err != nil {
+		return true
+	}
+	return time.Since(created) > r.gracePeriod
+}
+
+// canonicalCid returns the canonical string form of the given CID, as used by
+// the cluster. The CID is returned as is if it cannot be decoded.
+func canonicalCid(s string) string {
+	cid, err := ipfscid.Decode(s)
+	if err != nil {
+		return s
+	}
+	return cid.String()
+}
+
+// pinset returns the set of CIDs pinned by the cluster.
+func (r *reconciler) pinset() (map[string]struct{}, error) {
+	out := make(chan clusterapi.Pin, pageSize)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- r.client.Allocations(
+			r.ctx, clusterapi.DataType|clusterapi.MetaType, out)
+	}()
+	pinset := make(map[string]struct{})
+	for pin := range out {
+		pinset[pin.Cid.String()] = struct{}{}
+	}
+	return pinset, <-errc
+}
+
+// statuses returns the cluster's status of every pinned CID.
+func (r *reconciler) statuses() (map[string]clusterapi.GlobalPinInfo, error) {
+	out := make(chan clusterapi.GlobalPinInfo, pageSize)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- r.client.StatusAll(
+			r.ctx, clusterapi.TrackerStatusUndefined, false, out)
+	}()
+	statuses := make(map[string]clusterapi.GlobalPinInfo)
+	for gblPinInfo := range out {
+		statuses[gblPinInfo.Cid.String()] = gblPinInfo
+	}
+	return statuses, <-errc
+}
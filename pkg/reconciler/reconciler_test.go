@@ -0,0 +1,278 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	clusterapi "github.com/ipfs-cluster/ipfs-cluster/api"
+	ipfscid "github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crossedbot/axis/pkg/mocks"
+	"github.com/crossedbot/axis/pkg/pinner"
+	pinsdb "github.com/crossedbot/axis/pkg/pins/database"
+	"github.com/crossedbot/axis/pkg/pins/match"
+	"github.com/crossedbot/axis/pkg/pins/models"
+)
+
+func TestReconcilerReconcile(t *testing.T) {
+	ctx := context.Background()
+	pinned := models.PinStatus{
+		Id:      "pinnedpinsid",
+		Status:  "pinning",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:  "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv",
+			Name: "pinned",
+		},
+	}
+	missing := models.PinStatus{
+		Id:      "missingpinsid",
+		Status:  "pinned",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:  "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+			Name: "missing",
+		},
+	}
+	orphan := "QmNLei78zWmzUdbeRB3CiUfAizWUrbeeZh5K1rhAQKCh51"
+	pinnedCid, err := ipfscid.Decode(pinned.Pin.Cid)
+	require.Nil(t, err)
+	orphanCid, err := ipfscid.Decode(orphan)
+	require.Nil(t, err)
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDb := mocks.NewMockPins(mockCtrl)
+	mockIpfsClient := mocks.NewMockClient(mockCtrl)
+	mockPinner := mocks.NewMockPinner(mockCtrl)
+	mockWatcher := mocks.NewMockPinWatcher(mockCtrl)
+	mockIpfsClient.EXPECT().
+		Allocations(ctx, clusterapi.DataType|clusterapi.MetaType, gomock.Any()).
+		DoAndReturn(func(
+			_ context.Context,
+			_ clusterapi.PinType,
+			out chan<- clusterapi.Pin,
+		) error {
+			defer close(out)
+			out <- clusterapi.Pin{Cid: clusterapi.NewCid(pinnedCid)}
+			out <- clusterapi.Pin{Cid: clusterapi.NewCid(orphanCid)}
+			return nil
+		})
+	mockIpfsClient.EXPECT().
+		StatusAll(ctx, clusterapi.TrackerStatusUndefined, false, gomock.Any()).
+		DoAndReturn(func(
+			_ context.Context,
+			_ clusterapi.TrackerStatus,
+			_ bool,
+			out chan<- clusterapi.GlobalPinInfo,
+		) error {
+			defer close(out)
+			out <- clusterapi.GlobalPinInfo{
+				Cid: clusterapi.NewCid(pinnedCid),
+				PeerMap: map[string]clusterapi.PinInfoShort{
+					"peer": clusterapi.PinInfoShort{
+						Status: clusterapi.TrackerStatusPinned,
+					},
+				},
+			}
+			return nil
+		})
+	mockDb.EXPECT().
+		Find(
+			pinsdb.AllOwners, nil, nil, "", int64(0), int64(0), "",
+			pageSize, 0, nil,
+			&pinsdb.SortingKey{Field: "created", Ascending: true},
+			nil,
+		).
+		Return(models.Pins{
+			Count:   2,
+			Results: []models.PinStatus{pinned, missing},
+		}, nil)
+	mockDb.EXPECT().
+		Patch(pinned.Id, match.StatusPatch(map[string]interface{}{
+			"status": "pinned",
+			"info": models.Info{
+				"cluster_status":   "pinned",
+				"peer_status.peer": "pinned",
+			},
+		})).
+		Return(nil)
+	mockDb.EXPECT().
+		Patch(missing.Id, map[string]interface{}{"status": "queued"}).
+		Return(nil)
+	requeued := missing
+	requeued.Status = "queued"
+	mockWatcher.EXPECT().
+		Register(requeued, clusterapi.TrackerStatusPinned, gomock.Nil())
+	mockPinner.EXPECT().Add(missing.Pin).Return(nil)
+
+	r := &reconciler{
+		Mutex:       new(sync.Mutex),
+		ctx:         ctx,
+		client:      mockIpfsClient,
+		db:          mockDb,
+		pinner:      mockPinner,
+		watcher:     mockWatcher,
+		policy:      pinner.DefaultStatusPolicy,
+		gracePeriod: DefaultGracePeriod,
+	}
+	summary, err := r.Reconcile()
+	require.Nil(t, err)
+	require.Equal(t, 2, summary.Checked)
+	require.Equal(t, []string{pinned.Id}, summary.Corrected)
+	require.Equal(t, []string{missing.Id}, summary.Repinned)
+	require.Equal(t, []string{orphan}, summary.Orphaned)
+	require.Empty(t, summary.Errors)
+	require.Equal(t, summary, r.Last())
+}
+
+func TestReconcilerReconcileGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	recent := models.PinStatus{
+		Id:      "recentpinsid",
+		Status:  "queued",
+		Created: models.FormatTime(time.Now()),
+		Pin: models.Pin{
+			Cid:  "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+			Name: "recent",
+		},
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDb := mocks.NewMockPins(mockCtrl)
+	mockIpfsClient := mocks.NewMockClient(mockCtrl)
+	mockIpfsClient.EXPECT().
+		Allocations(ctx, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(
+			_ context.Context,
+			_ clusterapi.PinType,
+			out chan<- clusterapi.Pin,
+		) error {
+			close(out)
+			return nil
+		})
+	mockIpfsClient.EXPECT().
+		StatusAll(ctx, gomock.Any(), false, gomock.Any()).
+		DoAndReturn(func(
+			_ context.Context,
+			_ clusterapi.TrackerStatus,
+			_ bool,
+			out chan<- clusterapi.GlobalPinInfo,
+		) error {
+			close(out)
+			return nil
+		})
+	mockDb.EXPECT().
+		Find(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+			gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+			gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(models.Pins{
+			Count:   1,
+			Results: []models.PinStatus{recent},
+		}, nil)
+
+	// Pins within the grace period are not re-pinned, so neither the pinner
+	// nor the pin watcher are expected to be called
+	r := New(
+		ctx, mockIpfsClient, mockDb, nil, nil, pinner.DefaultStatusPolicy)
+	summary, err := r.Reconcile()
+	require.Nil(t, err)
+	require.Equal(t, 1, summary.Checked)
+	require.Empty(t, summary.Corrected)
+	require.Empty(t, summary.Repinned)
+	require.Empty(t, summary.Orphaned)
+}
+
+func TestReconcilerReconcileFailed(t *testing.T) {
+	ctx := context.Background()
+	failed := models.PinStatus{
+		Id:      "failedpinsid",
+		Status:  "failed",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:  "QmPAwR5un1YPJEF6iB7KvErDmAhiXxwL5J5qjA3Z9ceKqv",
+			Name: "failed",
+		},
+	}
+	missing := models.PinStatus{
+		Id:      "missingpinsid",
+		Status:  "pinned",
+		Created: "2021-05-14T13:46:40.000Z",
+		Pin: models.Pin{
+			Cid:     "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG",
+			Name:    "missing",
+			Origins: []string{"notamultiaddr"},
+		},
+		Info: models.Info{"cluster_status": "pinned"},
+	}
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockDb := mocks.NewMockPins(mockCtrl)
+	mockIpfsClient := mocks.NewMockClient(mockCtrl)
+	mockPinner := mocks.NewMockPinner(mockCtrl)
+	mockWatcher := mocks.NewMockPinWatcher(mockCtrl)
+	mockIpfsClient.EXPECT().
+		Allocations(ctx, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(
+			_ context.Context,
+			_ clusterapi.PinType,
+			out chan<- clusterapi.Pin,
+		) error {
+			close(out)
+			return nil
+		})
+	mockIpfsClient.EXPECT().
+		StatusAll(ctx, gomock.Any(), false, gomock.Any()).
+		DoAndReturn(func(
+			_ context.Context,
+			_ clusterapi.TrackerStatus,
+			_ bool,
+			out chan<- clusterapi.GlobalPinInfo,
+		) error {
+			close(out)
+			return nil
+		})
+	mockDb.EXPECT().
+		Find(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+			gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+			gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(models.Pins{
+			Count:   2,
+			Results: []models.PinStatus{failed, missing},
+		}, nil)
+	// the failed pin is not re-pinned; the missing pin fails to be
+	// re-pinned, and is marked as failed
+	mockDb.EXPECT().
+		Patch(missing.Id, map[string]interface{}{"status": "queued"}).
+		Return(nil)
+	requeued := missing
+	requeued.Status = "queued"
+	mockWatcher.EXPECT().
+		Register(requeued, clusterapi.TrackerStatusPinned, gomock.Nil())
+	mockPinner.EXPECT().
+		Add(missing.Pin).
+		Return(errors.New("invalid origin"))
+	mockWatcher.EXPECT().Deregister(missing.Id)
+	mockDb.EXPECT().
+		Patch(missing.Id, map[string]interface{}{
+			"status": "failed",
+			"info": models.Info{
+				"cluster_status": "pinned",
+				"status_details": "invalid origin",
+			},
+		}).
+		Return(nil)
+
+	r := New(ctx, mockIpfsClient, mockDb, mockPinner, mockWatcher,
+		pinner.DefaultStatusPolicy)
+	summary, err := r.Reconcile()
+	require.Nil(t, err)
+	require.Equal(t, 2, summary.Checked)
+	require.Empty(t, summary.Repinned)
+	require.Len(t, summary.Errors, 1)
+}
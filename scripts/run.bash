@@ -17,13 +17,14 @@ join_by()
 usage()
 {
     echo -e "$(basename "$0") [-h] [-c <configuration>] [-d <database address>]
-    [-i <ipfs address>] [-p <port>] [-g grant]...
+    [-D <database driver>] [-i <ipfs address>] [-p <port>] [-g grant]...
     -- program to start an Axis service
 
 where:
     -a  set authenticator address; default is 'http://127.0.0.1:8080/.well-known/jwks.json'
     -c  configuration file location; default is '${HOME}/.axis/axis.toml'
     -d  set database address; default is '127.0.0.1:6379'
+    -D  set database driver (redis, memory, postgres, or bolt); default is 'redis'
     -h  show this help text
     -i  set IPFS cluster multi-address; default is '/ip4/127.0.0.1/tcp/9094'
     -p  set listening port of HTTP API; default is 7070
@@ -36,11 +37,12 @@ where:
 conf="${HOME}/.axis/axis.toml"
 port=7070
 db_addr="127.0.0.1:6379"
+db_driver="redis"
 auth_addr="http://127.0.0.1:8080/.well-known/jwks.json"
 ipfs_addr="/ip4/127.0.0.1/tcp/9094"
 auth_grants=()
 
-while getopts "ha:c:d:p:i:g:" opt; do
+while getopts "ha:c:d:D:p:i:g:" opt; do
     case "$opt" in
     [h?]) usage
         ;;
@@ -50,6 +52,8 @@ while getopts "ha:c:d:p:i:g:" opt; do
         ;;
     d) db_addr="${OPTARG}"
         ;;
+    D) db_driver="${OPTARG}"
+        ;;
     i) ipfs_addr="${OPTARG}"
         ;;
     p) port="${OPTARG}"
@@ -74,6 +78,7 @@ port=${port}
 read_timeout=30
 write_timeout=30
 
+database_driver="${db_driver}"
 database_addr="${db_addr}"
 authenticator_addr="${auth_addr}"
 authentication_grants=${auth_grants_str}